@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"git.j3s.sh/vore/sqlite"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// checkPassword verifies the logged in user's password before
+// letting them do something drastic. wrong guesses count against
+// the same limit as failed logins, otherwise a stolen session
+// could be used to brute force the password.
+func (s *Site) checkPassword(w http.ResponseWriter, session sqlite.Session, password string) bool {
+	accountKey := strings.ToLower(session.Username)
+	if wait, locked := s.limiters.loginAccount.locked(accountKey); locked {
+		s.tooManyAttempts(w, wait)
+		return false
+	}
+	stored := s.db.GetPassword(session.Username)
+	err := bcrypt.CompareHashAndPassword([]byte(stored), []byte(password))
+	if err != nil {
+		s.limiters.loginAccount.fail(accountKey)
+		s.renderErr(w, "current password is wrong", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// passwordChangeHandler sets a new password for the user and logs
+// out every other device, in case the old password had leaked
+func (s *Site) passwordChangeHandler(w http.ResponseWriter, r *http.Request) {
+	session, ok := s.session(r)
+	if !ok {
+		s.renderErr(w, "", http.StatusUnauthorized)
+		return
+	}
+	if !s.checkPassword(w, session, r.FormValue("current")) {
+		return
+	}
+
+	password := r.FormValue("new")
+	err := validatePassword(session.Username, password)
+	if err != nil {
+		s.renderErr(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		s.renderErr(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = s.db.SetPassword(session.Username, string(hash))
+	if err != nil {
+		s.renderErr(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = s.db.DeleteOtherUserSessions(session.Username, session.ID)
+	if err != nil {
+		s.renderErr(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
+
+// accountDeleteHandler deletes the user and everything they own,
+// then lets go of any feeds that nobody else reads
+func (s *Site) accountDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	session, ok := s.session(r)
+	if !ok {
+		s.renderErr(w, "", http.StatusUnauthorized)
+		return
+	}
+	if r.FormValue("confirm") != session.Username {
+		s.renderErr(w, "type your username to confirm", http.StatusBadRequest)
+		return
+	}
+	if !s.checkPassword(w, session, r.FormValue("password")) {
+		return
+	}
+
+	orphaned, err := s.db.DeleteUser(session.Username)
+	if err != nil {
+		s.renderErr(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, url := range orphaned {
+		s.reaper.RemoveFeed(url)
+	}
+	// somebody could sign up with the name next
+	s.reaper.InvalidateUser(session.Username)
+
+	s.setCookie(w, &http.Cookie{
+		Name:   "session_token",
+		Value:  "",
+		MaxAge: -1,
+	})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
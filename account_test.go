@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestPasswordChange(t *testing.T) {
+	_, h := newTestSite(t)
+	laptop := register(t, h, "jes", "correct horse")
+	phone := login(t, h, "jes", "correct horse")
+
+	w := do(h, "POST", "/settings/password", url.Values{"current": {"wrong password"}, "new": {"battery staple"}}, laptop)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong current password: got status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	w = do(h, "POST", "/settings/password", url.Values{"current": {"correct horse"}, "new": {"short"}}, laptop)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("weak new password: got status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	w = do(h, "POST", "/settings/password", url.Values{"current": {"correct horse"}, "new": {"battery staple"}}, laptop)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	if w := do(h, "GET", "/settings", nil, laptop); w.Code != http.StatusOK {
+		t.Fatalf("the device that changed the password should stay logged in, got status %d", w.Code)
+	}
+	if w := do(h, "GET", "/settings", nil, phone); w.Code != http.StatusUnauthorized {
+		t.Fatalf("other devices should be logged out, got status %d", w.Code)
+	}
+
+	w = do(h, "POST", "/login", url.Values{"username": {"jes"}, "password": {"correct horse"}})
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("old password: got status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	login(t, h, "jes", "battery staple")
+}
+
+func TestAccountDeletion(t *testing.T) {
+	s, h := newTestSite(t)
+	shared := newFeedServer(t)
+	mine := newFeedServer(t)
+	jes := register(t, h, "jes", "correct horse")
+	wesley := register(t, h, "wesley", "battery staple")
+	do(h, "POST", "/settings/submit", url.Values{"submit": {shared.URL + "\r\n" + mine.URL}}, jes)
+	do(h, "POST", "/settings/submit", url.Values{"submit": {shared.URL}}, wesley)
+
+	w := do(h, "POST", "/settings/delete", url.Values{"confirm": {"wesley"}, "password": {"correct horse"}}, jes)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("wrong confirmation: got status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	w = do(h, "POST", "/settings/delete", url.Values{"confirm": {"jes"}, "password": {"battery staple"}}, jes)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong password: got status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	w = do(h, "POST", "/settings/delete", url.Values{"confirm": {"jes"}, "password": {"correct horse"}}, jes)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	if s.db.UserExists("jes") {
+		t.Fatal("jes should be gone")
+	}
+	if s.reaper.HasFeed(mine.URL) {
+		t.Fatal("feed nobody reads anymore should be gone from the reaper")
+	}
+	if !s.reaper.HasFeed(shared.URL) {
+		t.Fatal("feed wesley reads should stay in the reaper")
+	}
+	if w := do(h, "GET", "/jes", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("deleted user's homepage: got status %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
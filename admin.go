@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"git.j3s.sh/vore/reaper"
+	"git.j3s.sh/vore/sqlite"
+)
+
+// how many saves the admin page shows
+const recentSavesLimit = 20
+
+// isAdmin reports whether the client is logged in as an administrator
+func (s *Site) isAdmin(r *http.Request) bool {
+	username := s.username(r)
+	if username == "" {
+		return false
+	}
+	return s.db.IsAdmin(username)
+}
+
+// requireAdmin renders an error and returns false
+// unless the client is an administrator
+func (s *Site) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if !s.loggedIn(r) {
+		s.renderErr(w, "", http.StatusUnauthorized)
+		return false
+	}
+	if !s.isAdmin(r) {
+		s.renderErr(w, "only admins can do that", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// adminHandler gives admins an overview of the whole instance
+func (s *Site) adminHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	data := struct {
+		Users  []sqlite.User
+		Feeds  []sqlite.FeedInfo
+		Reaper reaper.Stats
+		Saves  []sqlite.SavedItem
+		Now    time.Time
+	}{
+		Users:  s.db.GetUsers(),
+		Feeds:  s.db.GetFeeds(),
+		Reaper: s.reaper.Stats(),
+		Saves:  s.db.GetRecentSavedItems(recentSavesLimit),
+		Now:    time.Now(),
+	}
+	s.renderPage(w, r, "admin", data)
+}
+
+// adminUserDisableHandler disables or re-enables an account
+func (s *Site) adminUserDisableHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	username := r.FormValue("username")
+	disabled := r.FormValue("disabled") == "true"
+	if disabled && username == s.username(r) {
+		s.renderErr(w, "you can't disable yourself", http.StatusBadRequest)
+		return
+	}
+	err := s.db.SetDisabled(username, disabled)
+	if err != nil {
+		s.renderErr(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// adminFeedDeleteHandler deletes a feed that nobody subscribes to
+func (s *Site) adminFeedDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	url := r.FormValue("url")
+	err := s.db.DeleteFeed(url)
+	if errors.Is(err, sqlite.ErrFeedInUse) {
+		e := fmt.Sprintf("can't delete %s: %s", url, err)
+		s.renderErr(w, e, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		s.renderErr(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.reaper.RemoveFeed(url)
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// adminFeedRefreshHandler refreshes a single feed right away, or
+// wakes up the reaper to refresh every stale feed if no url is given
+func (s *Site) adminFeedRefreshHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	url := r.FormValue("url")
+	if url == "" {
+		s.reaper.RefreshAll()
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+	if !s.reaper.HasFeed(url) {
+		e := fmt.Sprintf("no such feed '%s'", url)
+		s.renderErr(w, e, http.StatusBadRequest)
+		return
+	}
+	// fetch errors end up in the feed's fetch_error,
+	// which the admin page shows anyway
+	s.reaper.RefreshFeed(url)
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// newAdmin registers a user and makes them an admin
+func newAdmin(t *testing.T, s *Site, h http.Handler, username string) *http.Cookie {
+	t.Helper()
+	session := register(t, h, username, "correct horse")
+	if err := s.db.SetAdmin(username, true); err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
+
+func TestAdminRequiresAdmin(t *testing.T) {
+	_, h := newTestSite(t)
+	session := register(t, h, "wesley", "battery staple")
+
+	for _, path := range []string{"/admin", "/admin/invites"} {
+		if w := do(h, "GET", path, nil); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s logged out: got status %d, want %d", path, w.Code, http.StatusUnauthorized)
+		}
+		if w := do(h, "GET", path, nil, session); w.Code != http.StatusForbidden {
+			t.Errorf("%s as a regular user: got status %d, want %d", path, w.Code, http.StatusForbidden)
+		}
+	}
+	w := do(h, "POST", "/admin/users/disable", url.Values{"username": {"wesley"}, "disabled": {"true"}}, session)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestAdminPage(t *testing.T) {
+	s, h := newTestSite(t)
+	feed := newFeedServer(t)
+	admin := newAdmin(t, s, h, "jes")
+	wesley := register(t, h, "wesley", "battery staple")
+	do(h, "POST", "/settings/submit", url.Values{"submit": {feed.URL}}, wesley)
+
+	w := do(h, "GET", "/admin", nil, admin)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	for _, want := range []string{`href="/wesley"`, "1 subscriptions", "feeds, "} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("admin page should contain %q", want)
+		}
+	}
+}
+
+func TestAdminDisableUser(t *testing.T) {
+	s, h := newTestSite(t)
+	admin := newAdmin(t, s, h, "jes")
+	wesley := register(t, h, "wesley", "battery staple")
+
+	w := do(h, "POST", "/admin/users/disable", url.Values{"username": {"jes"}, "disabled": {"true"}}, admin)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("disabling yourself: got status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	w = do(h, "POST", "/admin/users/disable", url.Values{"username": {"wesley"}, "disabled": {"true"}}, admin)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	if w := do(h, "GET", "/settings", nil, wesley); w.Code != http.StatusUnauthorized {
+		t.Fatalf("disabled user's session: got status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	w = do(h, "POST", "/login", url.Values{"username": {"wesley"}, "password": {"battery staple"}})
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("disabled user login: got status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	do(h, "POST", "/admin/users/disable", url.Values{"username": {"wesley"}, "disabled": {"false"}}, admin)
+	login(t, h, "wesley", "battery staple")
+}
+
+func TestAdminDeleteFeed(t *testing.T) {
+	s, h := newTestSite(t)
+	feed := newFeedServer(t)
+	admin := newAdmin(t, s, h, "jes")
+	do(h, "POST", "/settings/submit", url.Values{"submit": {feed.URL}}, admin)
+
+	w := do(h, "POST", "/admin/feeds/delete", url.Values{"url": {feed.URL}}, admin)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("feed with subscribers: got status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	do(h, "POST", "/settings/submit", url.Values{"submit": {""}}, admin)
+	w = do(h, "POST", "/admin/feeds/delete", url.Values{"url": {feed.URL}}, admin)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("orphaned feed: got status %d: %s", w.Code, w.Body)
+	}
+	if s.reaper.HasFeed(feed.URL) {
+		t.Fatal("deleted feed should be gone from the reaper")
+	}
+}
+
+func TestAdminRefreshFeed(t *testing.T) {
+	s, h := newTestSite(t)
+	feed := newFeedServer(t)
+	admin := newAdmin(t, s, h, "jes")
+	do(h, "POST", "/settings/submit", url.Values{"submit": {feed.URL}}, admin)
+
+	if err := s.db.SetFeedFetchError(feed.URL, "it broke"); err != nil {
+		t.Fatal(err)
+	}
+	w := do(h, "POST", "/admin/feeds/refresh", url.Values{"url": {feed.URL}}, admin)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	if fetchErr, _ := s.db.GetFeedFetchError(feed.URL); fetchErr != "" {
+		t.Fatalf("a successful refresh should clear the fetch error, got %q", fetchErr)
+	}
+
+	w = do(h, "POST", "/admin/feeds/refresh", url.Values{"url": {"https://nowhere.example"}}, admin)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("unknown feed: got status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
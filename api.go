@@ -0,0 +1,474 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.j3s.sh/vore/rss"
+)
+
+const (
+	// maxAPIBody caps how much json a client may send
+	maxAPIBody = 1 << 20
+
+	// how many timeline items a page holds unless the client says otherwise
+	defaultAPIPageSize = 50
+	maxAPIPageSize     = 200
+)
+
+// apiRoute is an api endpoint along with everything the openapi
+// document needs to know about it. the api's routes are only ever
+// declared here, so the document can't drift from the handlers.
+type apiRoute struct {
+	method  string
+	path    string
+	summary string
+	// scope is the token scope the endpoint needs,
+	// or empty if anybody may call it
+	scope  string
+	params []apiParam
+	// request and response are zero values of the
+	// json bodies, nil when there isn't one
+	request  any
+	response any
+	// status is what a successful call returns
+	status  int
+	handler http.HandlerFunc
+}
+
+// apiParam is a path or query parameter
+type apiParam struct {
+	name        string
+	in          string
+	description string
+}
+
+// apiRoutes lists every endpoint under /api/v1
+func (s *Site) apiRoutes() []apiRoute {
+	urlParam := apiParam{"url", "path", "the feed's url, url-encoded"}
+	return []apiRoute{
+		{
+			method:   "GET",
+			path:     "/api/v1/subscriptions",
+			summary:  "list the feeds you subscribe to",
+			scope:    scopeRead,
+			response: []apiFeed{},
+			status:   http.StatusOK,
+			handler:  s.apiSubscriptionsHandler,
+		},
+		{
+			method:   "POST",
+			path:     "/api/v1/subscriptions",
+			summary:  "subscribe to a feed",
+			scope:    scopeWrite,
+			request:  apiURL{},
+			response: []apiFeed{},
+			status:   http.StatusCreated,
+			handler:  s.apiSubscribeHandler,
+		},
+		{
+			method:   "PUT",
+			path:     "/api/v1/subscriptions",
+			summary:  "replace all of your subscriptions",
+			scope:    scopeWrite,
+			request:  apiURLs{},
+			response: []apiFeed{},
+			status:   http.StatusOK,
+			handler:  s.apiSetSubscriptionsHandler,
+		},
+		{
+			method:  "DELETE",
+			path:    "/api/v1/subscriptions/{url}",
+			summary: "unsubscribe from a feed",
+			scope:   scopeWrite,
+			params:  []apiParam{urlParam},
+			status:  http.StatusNoContent,
+			handler: s.apiUnsubscribeHandler,
+		},
+		{
+			method:  "GET",
+			path:    "/api/v1/timeline",
+			summary: "page through your timeline, newest first",
+			scope:   scopeRead,
+			params: []apiParam{
+				{"limit", "query", "how many items to return, 1 to " + strconv.Itoa(maxAPIPageSize)},
+				{"before", "query", "a cursor from next: return the items older than it"},
+				{"after", "query", "a cursor from prev: return the items newer than it"},
+				{"feed", "query", "only return items from the feed with this url"},
+				{"domain", "query", "only return items linking to this domain"},
+				{"since", "query", "only return items published since this date (2006-01-02) or rfc 3339 time"},
+				{"until", "query", "only return items published up to the end of this date, or before this rfc 3339 time"},
+				{"q", "query", "only return items with this in their title, ignoring case"},
+			},
+			response: apiTimeline{},
+			status:   http.StatusOK,
+			handler:  s.apiTimelineHandler,
+		},
+		{
+			method:   "GET",
+			path:     "/api/v1/saves",
+			summary:  "list your saved items, newest first",
+			scope:    scopeRead,
+			response: []apiSave{},
+			status:   http.StatusOK,
+			handler:  s.apiSavesHandler,
+		},
+		{
+			method:   "POST",
+			path:     "/api/v1/saves",
+			summary:  "archive an item from your timeline and save it",
+			scope:    scopeWrite,
+			request:  apiURL{},
+			response: apiSave{},
+			status:   http.StatusCreated,
+			handler:  s.apiSaveHandler,
+		},
+		{
+			method:   "GET",
+			path:     "/api/v1/feeds/{url}",
+			summary:  "show a feed, including why it last failed to fetch",
+			params:   []apiParam{urlParam},
+			response: apiFeedDetails{},
+			status:   http.StatusOK,
+			handler:  s.apiFeedHandler,
+		},
+	}
+}
+
+// apiFeed is a feed as the api shows it
+type apiFeed struct {
+	URL   string `json:"url"`
+	Title string `json:"title"`
+}
+
+// apiFeedDetails is everything the api knows about a feed
+type apiFeedDetails struct {
+	URL         string    `json:"url"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Link        string    `json:"link"`
+	Subscribers int       `json:"subscribers"`
+	FetchError  string    `json:"fetch_error"`
+	Items       []apiItem `json:"items"`
+}
+
+// apiItem is a feed item as the api shows it
+type apiItem struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Title     string    `json:"title"`
+	Summary   string    `json:"summary"`
+	Published time.Time `json:"published"`
+}
+
+// apiTimeline is a page of the user's timeline. next links to
+// the older items and is missing on the last page, prev links to
+// the newer items and is missing on the first.
+type apiTimeline struct {
+	Items []apiItem `json:"items"`
+	Next  string    `json:"next,omitempty"`
+	Prev  string    `json:"prev,omitempty"`
+}
+
+// apiSave is a saved item as the api shows it
+type apiSave struct {
+	URL        string    `json:"url"`
+	Title      string    `json:"title"`
+	ArchiveURL string    `json:"archive_url"`
+	SavedAt    time.Time `json:"saved_at"`
+}
+
+// apiURL is a request body naming a single url
+type apiURL struct {
+	URL string `json:"url"`
+}
+
+// apiURLs is a request body naming a list of urls
+type apiURLs struct {
+	URLs []string `json:"urls"`
+}
+
+// apiError is the body of every failed api request
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func toAPIItems(items []*rss.Item) []apiItem {
+	result := []apiItem{}
+	for _, i := range items {
+		result = append(result, apiItem{
+			ID:        itemID(i),
+			URL:       i.Link,
+			Title:     i.Title,
+			Summary:   i.Summary,
+			Published: i.Date.UTC(),
+		})
+	}
+	return result
+}
+
+// writeJSON is the api's renderPage
+func (s *Site) writeJSON(w http.ResponseWriter, v any, code int) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// apiErr is the api's renderErr
+func (s *Site) apiErr(w http.ResponseWriter, error string, code int) {
+	if code == http.StatusInternalServerError {
+		log.Println(error)
+	}
+	s.writeJSON(w, apiError{Error: error}, code)
+}
+
+// readJSON decodes the request body into v, writing
+// the error response itself if it can't
+func (s *Site) readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBody)).Decode(v)
+	if err != nil {
+		s.apiErr(w, "can't parse request body: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// apiNotFoundHandler keeps unknown api paths from
+// falling through to the html site
+func (s *Site) apiNotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	s.apiErr(w, "no such endpoint", http.StatusNotFound)
+}
+
+func (s *Site) apiSubscriptions(username string) []apiFeed {
+	feeds := []apiFeed{}
+	for _, f := range s.reaper.GetUserFeeds(username) {
+		feeds = append(feeds, apiFeed{URL: f.UpdateURL, Title: f.Title})
+	}
+	return feeds
+}
+
+// apiSubscriptionsHandler lists the user's subscriptions
+func (s *Site) apiSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := s.apiUser(w, r, scopeRead)
+	if !ok {
+		return
+	}
+	s.writeJSON(w, s.apiSubscriptions(username), http.StatusOK)
+}
+
+// apiSubscribeHandler adds a single feed to the user's subscriptions
+func (s *Site) apiSubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := s.apiUser(w, r, scopeWrite)
+	if !ok {
+		return
+	}
+	var body apiURL
+	if !s.readJSON(w, r, &body) {
+		return
+	}
+	if strings.TrimSpace(body.URL) == "" {
+		s.apiErr(w, "url is required", http.StatusBadRequest)
+		return
+	}
+
+	// only this one feed is touched, so subscribes
+	// racing each other can't undo one another
+	urls, err := s.addFeeds([]string{body.URL})
+	if errors.Is(err, errBadFeed) {
+		s.apiErr(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		s.apiErr(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	added, err := s.db.Subscribe(username, urls[0])
+	if err != nil {
+		s.apiErr(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !added {
+		s.writeJSON(w, s.apiSubscriptions(username), http.StatusOK)
+		return
+	}
+	s.reaper.InvalidateUser(username)
+	s.writeJSON(w, s.apiSubscriptions(username), http.StatusCreated)
+}
+
+// apiSetSubscriptionsHandler replaces the user's subscriptions,
+// just like the textarea in /settings does
+func (s *Site) apiSetSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := s.apiUser(w, r, scopeWrite)
+	if !ok {
+		return
+	}
+	var body apiURLs
+	if !s.readJSON(w, r, &body) {
+		return
+	}
+	if !s.apiWriteSubscriptions(w, username, body.URLs) {
+		return
+	}
+	s.writeJSON(w, s.apiSubscriptions(username), http.StatusOK)
+}
+
+// apiUnsubscribeHandler drops a single feed from the user's subscriptions
+func (s *Site) apiUnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := s.apiUser(w, r, scopeWrite)
+	if !ok {
+		return
+	}
+	feedURL, err := url.QueryUnescape(r.PathValue("url"))
+	if err != nil {
+		s.apiErr(w, "can't decode url: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	removed, err := s.db.Unsubscribe(username, feedURL)
+	if err != nil {
+		s.apiErr(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !removed {
+		s.apiErr(w, "you aren't subscribed to "+feedURL, http.StatusNotFound)
+		return
+	}
+	s.reaper.InvalidateUser(username)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiWriteSubscriptions is setSubscriptions with api errors
+func (s *Site) apiWriteSubscriptions(w http.ResponseWriter, username string, urls []string) bool {
+	err := s.setSubscriptions(username, urls)
+	if errors.Is(err, errBadFeed) {
+		s.apiErr(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if err != nil {
+		s.apiErr(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// apiTimelineHandler returns a page of the user's homepage
+func (s *Site) apiTimelineHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := s.apiUser(w, r, scopeRead)
+	if !ok {
+		return
+	}
+	limit, err := formInt(r, "limit", defaultAPIPageSize, 1, maxAPIPageSize)
+	if err != nil {
+		s.apiErr(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// offsets shift as new items come in, so clients
+	// holding on to one should hear that it's gone
+	if r.FormValue("offset") != "" {
+		s.apiErr(w, "offset is gone, follow next or pass before= instead", http.StatusBadRequest)
+		return
+	}
+	page, err := s.requestedPage(r, username, limit)
+	if err != nil {
+		s.apiErr(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result := apiTimeline{Items: toAPIItems(page.Items)}
+	if page.Older != "" {
+		result.Next = pageLink(r, "before", page.Older)
+	}
+	if page.Newer != "" {
+		result.Prev = pageLink(r, "after", page.Newer)
+	}
+	s.writeJSON(w, result, http.StatusOK)
+}
+
+// apiSavesHandler lists the user's saved items, newest first
+func (s *Site) apiSavesHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := s.apiUser(w, r, scopeRead)
+	if !ok {
+		return
+	}
+	saves := []apiSave{}
+	for _, si := range s.db.GetUserSavedItems(username) {
+		saves = append(saves, apiSave{
+			URL:        si.ItemURL,
+			Title:      si.ItemTitle,
+			ArchiveURL: si.ArchiveURL,
+			SavedAt:    si.CreatedAt,
+		})
+	}
+	s.writeJSON(w, saves, http.StatusOK)
+}
+
+// apiSaveHandler archives an item and adds it to the user's saves
+func (s *Site) apiSaveHandler(w http.ResponseWriter, r *http.Request) {
+	username, ok := s.apiUser(w, r, scopeWrite)
+	if !ok {
+		return
+	}
+	var body apiURL
+	if !s.readJSON(w, r, &body) {
+		return
+	}
+
+	si, err := s.save(username, body.URL)
+	if errors.Is(err, errItemNotFound) {
+		s.apiErr(w, "no feed has an item linking to "+body.URL, http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, errArchive) {
+		log.Println(err)
+		s.apiErr(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if err != nil {
+		s.apiErr(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, apiSave{
+		URL:        si.ItemURL,
+		Title:      si.ItemTitle,
+		ArchiveURL: si.ArchiveURL,
+		SavedAt:    si.CreatedAt,
+	}, http.StatusCreated)
+}
+
+// apiFeedHandler is the api's feedDetailsHandler
+func (s *Site) apiFeedHandler(w http.ResponseWriter, r *http.Request) {
+	feedURL, err := url.QueryUnescape(r.PathValue("url"))
+	if err != nil {
+		s.apiErr(w, "can't decode url: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	f := s.reaper.GetFeed(feedURL)
+	if f == nil {
+		s.apiErr(w, "vore doesn't know about "+feedURL, http.StatusNotFound)
+		return
+	}
+	fetchErr, err := s.db.GetFeedFetchError(feedURL)
+	if err != nil {
+		s.apiErr(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.writeJSON(w, apiFeedDetails{
+		URL:         f.UpdateURL,
+		Title:       f.Title,
+		Description: f.Description,
+		Link:        f.Link,
+		Subscribers: s.db.GetSubscriberCount(feedURL),
+		FetchError:  fetchErr,
+		Items:       toAPIItems(f.Items),
+	}, http.StatusOK)
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeArchiver archives without going anywhere near the wayback machine
+type fakeArchiver struct {
+	err error
+}
+
+func (a fakeArchiver) Archive(ctx context.Context, u string) (string, error) {
+	if a.err != nil {
+		return "", a.err
+	}
+	return "https://archive.example/" + u, nil
+}
+
+// newBigFeedServer serves a feed with n items, newest first
+func newBigFeedServer(t *testing.T, n int) *httptest.Server {
+	t.Helper()
+	newest := time.Date(2006, 1, 28, 15, 4, 5, 0, time.UTC)
+	var items strings.Builder
+	for i := range n {
+		fmt.Fprintf(&items, `<item>
+		<title>post %d</title>
+		<link>https://blog.example/%d</link>
+		<pubDate>%s</pubDate>
+	</item>`, i, i, newest.Add(-time.Duration(i)*time.Hour).Format(time.RFC1123))
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0"><channel><title>big feed</title>%s</channel></rss>`, items.String())
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func decode[T any](t *testing.T, w *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	err := json.Unmarshal(w.Body.Bytes(), &v)
+	if err != nil {
+		t.Fatalf("can't decode %s: %s", w.Body, err)
+	}
+	return v
+}
+
+func TestAPISubscribeAndUnsubscribe(t *testing.T) {
+	_, h := newTestSite(t)
+	first := newFeedServer(t)
+	second := newFeedServer(t)
+	session := register(t, h, "jes", "correct horse")
+	token := newAPIToken(t, h, session, scopeWrite)
+
+	w := apiDo(h, "POST", "/api/v1/subscriptions", token, `{"url": "`+first.URL+`"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("subscribe: got status %d: %s", w.Code, w.Body)
+	}
+	w = apiDo(h, "POST", "/api/v1/subscriptions", token, `{"url": "`+second.URL+`"}`)
+	if feeds := decode[[]apiFeed](t, w); len(feeds) != 2 {
+		t.Fatalf("got feeds %+v, want both", feeds)
+	}
+	w = apiDo(h, "POST", "/api/v1/subscriptions", token, `{"url": "`+first.URL+`"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("subscribing twice: got status %d, want %d", w.Code, http.StatusOK)
+	}
+	w = apiDo(h, "POST", "/api/v1/subscriptions", token, `{"url": "not a url"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("bad url: got status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	w = apiDo(h, "DELETE", "/api/v1/subscriptions/"+url.QueryEscape(first.URL), token, "")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("unsubscribe: got status %d: %s", w.Code, w.Body)
+	}
+	w = apiDo(h, "DELETE", "/api/v1/subscriptions/"+url.QueryEscape(first.URL), token, "")
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("unsubscribing twice: got status %d, want %d", w.Code, http.StatusNotFound)
+	}
+	w = apiDo(h, "GET", "/api/v1/subscriptions", token, "")
+	if feeds := decode[[]apiFeed](t, w); len(feeds) != 1 || feeds[0].URL != second.URL {
+		t.Fatalf("got feeds %+v, want just %s", feeds, second.URL)
+	}
+}
+
+func TestAPIConcurrentSubscribes(t *testing.T) {
+	_, h := newTestSite(t)
+	session := register(t, h, "jes", "correct horse")
+	token := newAPIToken(t, h, session, scopeWrite)
+	var feeds []string
+	for range 8 {
+		feeds = append(feeds, newFeedServer(t).URL)
+	}
+	// the last one goes away while the others are added
+	apiDo(h, "POST", "/api/v1/subscriptions", token, `{"url": "`+feeds[7]+`"}`)
+
+	var wg sync.WaitGroup
+	for _, feed := range feeds[:7] {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			apiDo(h, "POST", "/api/v1/subscriptions", token, `{"url": "`+feed+`"}`)
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		apiDo(h, "DELETE", "/api/v1/subscriptions/"+url.QueryEscape(feeds[7]), token, "")
+	}()
+	wg.Wait()
+
+	w := apiDo(h, "GET", "/api/v1/subscriptions", token, "")
+	if got := decode[[]apiFeed](t, w); len(got) != 7 {
+		t.Fatalf("got %d feeds, want 7: %+v", len(got), got)
+	}
+}
+
+func TestAPITimelinePages(t *testing.T) {
+	_, h := newTestSite(t)
+	feed := newBigFeedServer(t, 5)
+	session := register(t, h, "jes", "correct horse")
+	token := newAPIToken(t, h, session, scopeWrite)
+	apiDo(h, "POST", "/api/v1/subscriptions", token, `{"url": "`+feed.URL+`"}`)
+
+	// walk collects titles from link onwards, until
+	// follow says there are no more pages
+	walk := func(link string, follow func(apiTimeline) string) string {
+		var titles []string
+		for link != "" {
+			w := apiDo(h, "GET", link, token, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("%s: got status %d: %s", link, w.Code, w.Body)
+			}
+			page := decode[apiTimeline](t, w)
+			if len(page.Items) > 2 {
+				t.Fatalf("%s: got %d items, want at most 2", link, len(page.Items))
+			}
+			for _, i := range page.Items {
+				titles = append(titles, i.Title)
+			}
+			link = follow(page)
+		}
+		return strings.Join(titles, ",")
+	}
+	older := func(p apiTimeline) string { return p.Next }
+	if got, want := walk("/api/v1/timeline?limit=2", older), "post 0,post 1,post 2,post 3,post 4"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+
+	w := apiDo(h, "GET", "/api/v1/timeline?limit=2", token, "")
+	first := decode[apiTimeline](t, w)
+	if first.Prev != "" {
+		t.Fatalf("the first page has nothing newer, got prev %s", first.Prev)
+	}
+	w = apiDo(h, "GET", first.Next, token, "")
+	second := decode[apiTimeline](t, w)
+	if second.Prev == "" {
+		t.Fatal("the second page should link back")
+	}
+	newer := func(p apiTimeline) string { return p.Prev }
+	if got, want := walk(second.Prev, newer), "post 0,post 1"; got != want {
+		t.Fatalf("walking back: got %s, want %s", got, want)
+	}
+
+	for _, q := range []string{"limit=0", "limit=1000", "offset=2", "limit=lots", "before=garbage", "before=" + first.Items[0].ID + "&after=x"} {
+		if w := apiDo(h, "GET", "/api/v1/timeline?"+q, token, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want %d", q, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestAPISaves(t *testing.T) {
+	s, h := newTestSite(t)
+	feed := newFeedServer(t)
+	session := register(t, h, "jes", "correct horse")
+	token := newAPIToken(t, h, session, scopeWrite)
+	apiDo(h, "POST", "/api/v1/subscriptions", token, `{"url": "`+feed.URL+`"}`)
+
+	s.archiver = fakeArchiver{err: errors.New("wayback is down")}
+	w := apiDo(h, "POST", "/api/v1/saves", token, `{"url": "https://blog.example/hello"}`)
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("archive failure: got status %d, want %d", w.Code, http.StatusBadGateway)
+	}
+
+	s.archiver = fakeArchiver{}
+	w = apiDo(h, "POST", "/api/v1/saves", token, `{"url": "https://blog.example/nope"}`)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("unknown item: got status %d, want %d", w.Code, http.StatusNotFound)
+	}
+	w = apiDo(h, "POST", "/api/v1/saves", token, `{"url": "https://blog.example/hello"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("save: got status %d: %s", w.Code, w.Body)
+	}
+	saved := decode[apiSave](t, w)
+	if saved.Title != "hello from the test feed" || saved.ArchiveURL != "https://archive.example/https://blog.example/hello" {
+		t.Fatalf("got save %+v", saved)
+	}
+
+	w = apiDo(h, "GET", "/api/v1/saves", token, "")
+	if saves := decode[[]apiSave](t, w); len(saves) != 1 || saves[0].URL != "https://blog.example/hello" {
+		t.Fatalf("got saves %+v", saves)
+	}
+}
+
+func TestAPIFeedDetails(t *testing.T) {
+	s, h := newTestSite(t)
+	feed := newFeedServer(t)
+	session := register(t, h, "jes", "correct horse")
+	do(h, "POST", "/settings/submit", url.Values{"submit": {feed.URL}}, session)
+	err := s.db.SetFeedFetchError(feed.URL, "connection refused")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// feed details are public, like /feeds/{url}
+	w := apiDo(h, "GET", "/api/v1/feeds/"+url.QueryEscape(feed.URL), "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	details := decode[apiFeedDetails](t, w)
+	if details.Title != "test feed" || details.Subscribers != 1 || details.FetchError != "connection refused" || len(details.Items) != 1 {
+		t.Fatalf("got details %+v", details)
+	}
+
+	w = apiDo(h, "GET", "/api/v1/feeds/"+url.QueryEscape("https://nope.example"), "", "")
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("unknown feed: got status %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestAPIUnknownEndpoint(t *testing.T) {
+	_, h := newTestSite(t)
+	w := apiDo(h, "GET", "/api/v1/nope", "", "")
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if e := decode[apiError](t, w); e.Error == "" {
+		t.Fatal("unknown endpoints should get a json error")
+	}
+}
+
+func TestOpenAPICoversEveryRoute(t *testing.T) {
+	s, h := newTestSite(t)
+	w := apiDo(h, "GET", "/api/v1/openapi.json", "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	doc := decode[struct {
+		OpenAPI string                               `json:"openapi"`
+		Paths   map[string]map[string]map[string]any `json:"paths"`
+	}](t, w)
+	if doc.OpenAPI == "" {
+		t.Fatal("missing openapi version")
+	}
+	for _, rt := range s.apiRoutes() {
+		op, ok := doc.Paths[rt.path][strings.ToLower(rt.method)]
+		if !ok {
+			t.Errorf("%s %s is missing from the document", rt.method, rt.path)
+			continue
+		}
+		if rt.response != nil && !strings.Contains(fmt.Sprint(op["responses"]), "schema") {
+			t.Errorf("%s %s should describe its response", rt.method, rt.path)
+		}
+	}
+
+	schema := jsonSchema(reflect.TypeOf(apiTimeline{}))
+	props := schema["properties"].(map[string]any)
+	if _, ok := props["next"]; !ok {
+		t.Fatalf("schema should follow json tags, got %v", schema)
+	}
+	if fmt.Sprint(schema["required"]) != "[items]" {
+		t.Fatalf("omitempty fields shouldn't be required, got %v", schema["required"])
+	}
+}
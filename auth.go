@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// registrationMode controls who may create an account
+type registrationMode string
+
+const (
+	registrationOpen   registrationMode = "open"
+	registrationInvite registrationMode = "invite"
+	registrationClosed registrationMode = "closed"
+)
+
+func parseRegistrationMode(mode string) (registrationMode, error) {
+	switch m := registrationMode(mode); m {
+	case registrationOpen, registrationInvite, registrationClosed:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown registration mode '%s', want open, invite or closed", mode)
+}
+
+// errInvalidLogin is the only thing a failed login ever says, so
+// that it can't be used to find out which usernames exist
+var errInvalidLogin = errors.New("invalid username or password")
+
+// errAccountDisabled is only ever shown to somebody who
+// knows the account's password
+var errAccountDisabled = errors.New("this account has been disabled by an admin")
+
+// dummyHash is compared against when a user doesn't exist, so that
+// logins for unknown users take as long as for known ones
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("vore vore vore"), bcrypt.DefaultCost)
+
+const (
+	minPasswordLength = 8
+	// bcrypt ignores everything past 72 bytes
+	maxPasswordBytes = 72
+)
+
+// validatePassword enforces vore's password policy
+func validatePassword(username string, password string) error {
+	if utf8.RuneCountInString(password) < minPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	if len(password) > maxPasswordBytes {
+		return fmt.Errorf("password must be at most %d bytes", maxPasswordBytes)
+	}
+	if strings.EqualFold(password, username) {
+		return fmt.Errorf("password can't be your username")
+	}
+	return nil
+}
+
+// limiters for everything an attacker would like to hammer on
+type limiters struct {
+	// failed logins from a single ip, across any accounts
+	loginIP *limiter
+	// failed logins against a single account, from any ip
+	loginAccount *limiter
+	// every registration attempt from a single ip
+	register *limiter
+}
+
+func newLimiters() limiters {
+	return limiters{
+		loginIP:      newLimiter(20, 15*time.Minute, 15*time.Minute),
+		loginAccount: newLimiter(5, 15*time.Minute, 15*time.Minute),
+		register:     newLimiter(5, time.Hour, time.Hour),
+	}
+}
+
+// clientIP returns the ip address of the client that sent r. behind
+// a proxy, that's the last address the proxy appended to
+// X-Forwarded-For, anything before it is client-controlled.
+func (s *Site) clientIP(r *http.Request) string {
+	if s.behindTLSProxy {
+		forwarded := r.Header.Values("X-Forwarded-For")
+		if len(forwarded) > 0 {
+			hops := strings.Split(forwarded[len(forwarded)-1], ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// tooManyAttempts renders a lockout error
+func (s *Site) tooManyAttempts(w http.ResponseWriter, wait time.Duration) {
+	wait = wait.Round(time.Minute) + time.Minute
+	w.Header().Set("Retry-After", fmt.Sprint(int(wait.Seconds())))
+	e := fmt.Sprintf("too many attempts, try again in %s", wait)
+	s.renderErr(w, e, http.StatusTooManyRequests)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestLoginErrorsAreUniform(t *testing.T) {
+	_, h := newTestSite(t)
+	register(t, h, "jes", "correct horse")
+
+	unknown := do(h, "POST", "/login", url.Values{"username": {"nobody"}, "password": {"correct horse"}})
+	wrong := do(h, "POST", "/login", url.Values{"username": {"jes"}, "password": {"battery staple"}})
+	if unknown.Code != wrong.Code || unknown.Body.String() != wrong.Body.String() {
+		t.Fatalf("unknown user got %d %q, wrong password got %d %q",
+			unknown.Code, unknown.Body, wrong.Code, wrong.Body)
+	}
+	if strings.Contains(unknown.Body.String(), "nobody") {
+		t.Fatal("login errors should not echo the username")
+	}
+}
+
+func TestLoginAccountLockout(t *testing.T) {
+	_, h := newTestSite(t)
+	register(t, h, "jes", "correct horse")
+
+	for i := 0; i < 5; i++ {
+		w := do(h, "POST", "/login", url.Values{"username": {"jes"}, "password": {"guess " + fmt.Sprint(i)}})
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: got status %d, want %d", i, w.Code, http.StatusUnauthorized)
+		}
+	}
+
+	// even the right password is refused while locked out
+	w := do(h, "POST", "/login", url.Values{"username": {"JES"}, "password": {"correct horse"}})
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Fatal("lockout should say when to retry")
+	}
+}
+
+func TestLoginIPLimit(t *testing.T) {
+	s, h := newTestSite(t)
+	// keep the test quick, the real limit is the same code
+	s.limiters.loginIP = newLimiter(3, 1<<62, 1<<62)
+
+	for i := 0; i < 3; i++ {
+		do(h, "POST", "/login", url.Values{"username": {fmt.Sprint("user", i)}, "password": {"hunter22"}})
+	}
+	w := do(h, "POST", "/login", url.Values{"username": {"someone-else"}, "password": {"hunter22"}})
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestRegisterRateLimit(t *testing.T) {
+	_, h := newTestSite(t)
+	for i := 0; i < 5; i++ {
+		// invalid attempts count too
+		do(h, "POST", "/register", url.Values{"username": {fmt.Sprint("user", i)}, "password": {"short"}})
+	}
+	w := do(h, "POST", "/register", url.Values{"username": {"jes"}, "password": {"correct horse"}})
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	_, h := newTestSite(t)
+	tests := map[string]string{
+		"":                      "empty",
+		"short":                 "too short",
+		"jessica1":              "same as the username",
+		strings.Repeat("a", 73): "longer than bcrypt will read",
+	}
+	for password, why := range tests {
+		w := do(h, "POST", "/register", url.Values{"username": {"jessica1"}, "password": {password}})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("password %s: got status %d, want %d", why, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestRegistrationModes(t *testing.T) {
+	for _, mode := range []registrationMode{registrationClosed, registrationInvite} {
+		s, h := newTestSite(t)
+		s.registration = mode
+
+		w := do(h, "POST", "/register", url.Values{"username": {"jes"}, "password": {"correct horse"}})
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: got status %d, want %d", mode, w.Code, http.StatusForbidden)
+		}
+		if s.db.UserExists("jes") {
+			t.Errorf("%s: user should not have been created", mode)
+		}
+		body := do(h, "GET", "/login", nil).Body.String()
+		switch mode {
+		case registrationClosed:
+			if strings.Contains(body, `action="/register"`) {
+				t.Errorf("%s: login page should not offer registration", mode)
+			}
+		case registrationInvite:
+			if !strings.Contains(body, `name="invite"`) {
+				t.Errorf("%s: login page should ask for an invite code", mode)
+			}
+		}
+	}
+
+	if _, err := parseRegistrationMode("whenever"); err == nil {
+		t.Error("expected an error for an unknown registration mode")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	s, _ := newTestSite(t)
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:5544"
+	r.Header.Set("X-Forwarded-For", "6.6.6.6, 203.0.113.7")
+
+	if got := s.clientIP(r); got != "10.0.0.1" {
+		t.Errorf("without a proxy: got %s, want the remote addr", got)
+	}
+	s.behindTLSProxy = true
+	if got := s.clientIP(r); got != "203.0.113.7" {
+		t.Errorf("behind a proxy: got %s, want the address the proxy saw", got)
+	}
+}
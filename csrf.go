@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+
+	"git.j3s.sh/vore/lib"
+)
+
+// csrfCookie holds a random value for clients without a session, so
+// that the login & register forms can be protected too. once logged
+// in, tokens are bound to the session cookie instead.
+const csrfCookie = "csrf"
+
+// csrfField is the form field (or X-CSRF-Token header) that
+// every state-changing request must carry
+const csrfField = "csrf_token"
+
+// csrf rejects state-changing requests that don't carry the csrf
+// token for the client's session. a cross-site page can make the
+// browser send our cookies, but it can't read them, so it has no way
+// to come up with the matching token.
+//
+// requests carrying an api token are let through untouched. browsers
+// never add a bearer token on their own, so a cross-site page can't
+// forge one, and apiUser ignores cookies on such requests. the same
+// goes for the fever api, which only looks at the api_key field.
+func (s *Site) csrf(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := bearerToken(r); ok || r.URL.Path == feverPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if csrfSecret(r) == "" {
+			secret := lib.GenerateSecureToken(32)
+			c := &http.Cookie{
+				Name:  csrfCookie,
+				Value: secret,
+			}
+			s.setCookie(w, c)
+			// make the token available to this request's page too
+			r.AddCookie(c)
+		}
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			got := r.Header.Get("X-CSRF-Token")
+			if got == "" {
+				got = r.FormValue(csrfField)
+			}
+			if !hmac.Equal([]byte(got), []byte(csrfToken(r))) {
+				s.renderErr(w, "invalid or missing csrf token, try reloading the page", http.StatusForbidden)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// csrfToken returns the token that forms rendered for r must submit
+func csrfToken(r *http.Request) string {
+	secret := csrfSecret(r)
+	if secret == "" {
+		return ""
+	}
+	return csrfTokenFor(secret)
+}
+
+// csrfSecret is the value csrf tokens are bound to: the session
+// token if there is one, the anonymous csrf cookie otherwise
+func csrfSecret(r *http.Request) string {
+	if c, err := r.Cookie("session_token"); err == nil && c.Value != "" {
+		return c.Value
+	}
+	if c, err := r.Cookie(csrfCookie); err == nil && c.Value != "" {
+		return c.Value
+	}
+	return ""
+}
+
+func csrfTokenFor(secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("vore csrf"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCSRFRejectsMissingToken(t *testing.T) {
+	s, h := newTestSite(t)
+	session := register(t, h, "jes", "correct horse")
+	s.db.WriteFeed("https://a.example/feed")
+	err := s.db.BatchSubscribe("jes", []string{"https://a.example/feed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// what a malicious page posting to vore would look like
+	form := url.Values{"submit": {""}}
+	w := doRaw(h, "POST", "/settings/submit", form, session)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if got := s.db.GetUserFeedURLs("jes"); len(got) != 1 {
+		t.Fatalf("subscriptions were changed by a forged request: %v", got)
+	}
+
+	for _, path := range []string{"/logout", "/login", "/register", "/save/x", "/settings/sessions/revoke"} {
+		w := doRaw(h, "POST", path, url.Values{}, session)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: got status %d, want %d", path, w.Code, http.StatusForbidden)
+		}
+	}
+}
+
+func TestCSRFRejectsOtherSessionsToken(t *testing.T) {
+	_, h := newTestSite(t)
+	jes := register(t, h, "jes", "correct horse")
+	wesley := register(t, h, "wesley", "battery staple")
+
+	form := url.Values{"submit": {""}, csrfField: {csrfTokenFor(wesley.Value)}}
+	w := doRaw(h, "POST", "/settings/submit", form, jes)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestCSRFTokenRendered(t *testing.T) {
+	_, h := newTestSite(t)
+
+	// an anonymous visitor gets a cookie to bind the login form to
+	w := do(h, "GET", "/login", nil)
+	var anon *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == csrfCookie {
+			anon = c
+		}
+	}
+	if anon == nil {
+		t.Fatal("login page should set a csrf cookie")
+	}
+	if !strings.Contains(w.Body.String(), csrfTokenFor(anon.Value)) {
+		t.Fatal("login page should contain the csrf token")
+	}
+
+	session := register(t, h, "jes", "correct horse")
+	w = do(h, "GET", "/settings", nil, session)
+	if !strings.Contains(w.Body.String(), csrfTokenFor(session.Value)) {
+		t.Fatal("settings page should contain the session's csrf token")
+	}
+}
+
+func TestStateChangingGETsAreGone(t *testing.T) {
+	_, h := newTestSite(t)
+	session := register(t, h, "jes", "correct horse")
+
+	// GET /save falls through to the published feeds route,
+	// which doesn't know about any file called that
+	w := do(h, "GET", "/save/https%3A%2F%2Fblog.example%2Fhello", nil, session)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET /save: got status %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	// GET /logout falls through to the homepage route now,
+	// and must not log anybody out
+	do(h, "GET", "/logout", nil, session)
+	if w := do(h, "GET", "/settings", nil, session); w.Code != http.StatusOK {
+		t.Errorf("GET /logout logged the user out: settings got status %d", w.Code)
+	}
+}
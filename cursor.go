@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.j3s.sh/vore/reaper"
+	"git.j3s.sh/vore/rss"
+)
+
+// timelinePageSize is how many items a homepage shows at once
+const timelinePageSize = 50
+
+var errBadCursor = errors.New("that's not a cursor vore gave out")
+
+// cursor is a spot in a timeline, just before or after the
+// item it was made from. timelines are in a fixed order (see
+// reaper.Precedes), so a cursor still points at the same spot
+// when items come & go around it.
+type cursor struct {
+	date time.Time
+	key  string
+}
+
+func cursorOf(i *rss.Item) cursor {
+	return cursor{date: i.Date, key: reaper.TimelineKey(i)}
+}
+
+// precedes reports whether c comes before d in a timeline,
+// it's reaper.Precedes for cursors
+func (c cursor) precedes(d cursor) bool {
+	if !c.date.Equal(d.date) {
+		return c.date.After(d.date)
+	}
+	return c.key < d.key
+}
+
+// String makes c opaque, clients should pass it back as is.
+// seconds & nanoseconds go separately: UnixNano can't hold the
+// zero time that undated items have.
+func (c cursor) String() string {
+	raw := strconv.FormatInt(c.date.Unix(), 10) + "." + strconv.Itoa(c.date.Nanosecond()) + "~" + c.key
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func parseCursor(s string) (cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, errBadCursor
+	}
+	date, key, ok := strings.Cut(string(raw), "~")
+	if !ok {
+		return cursor{}, errBadCursor
+	}
+	secs, nanos, ok := strings.Cut(date, ".")
+	if !ok {
+		return cursor{}, errBadCursor
+	}
+	sec, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return cursor{}, errBadCursor
+	}
+	nsec, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil || nsec < 0 || nsec >= int64(time.Second) {
+		return cursor{}, errBadCursor
+	}
+	return cursor{date: time.Unix(sec, nsec), key: key}, nil
+}
+
+// timelinePage is a page of a timeline, along with
+// cursors for the pages either side of it
+type timelinePage struct {
+	Items []*rss.Item
+	// Older goes in ?before= for the next page, Newer goes
+	// in ?after= for the previous one. they're empty at
+	// either end of the timeline.
+	Older string
+	Newer string
+}
+
+// paginate cuts a page of up to limit items out of items, which
+// must be in timeline order. before & after are cursors from an
+// earlier page: the page is the items just older than before, or
+// just newer than after. with neither, it's the newest items.
+func paginate(items []*rss.Item, before string, after string, limit int) (timelinePage, error) {
+	start, end := 0, min(limit, len(items))
+	switch {
+	case before != "" && after != "":
+		return timelinePage{}, errors.New("before and after can't be used together")
+	case before != "":
+		c, err := parseCursor(before)
+		if err != nil {
+			return timelinePage{}, err
+		}
+		start = sort.Search(len(items), func(i int) bool { return c.precedes(cursorOf(items[i])) })
+		end = min(start+limit, len(items))
+	case after != "":
+		c, err := parseCursor(after)
+		if err != nil {
+			return timelinePage{}, err
+		}
+		end = sort.Search(len(items), func(i int) bool { return !cursorOf(items[i]).precedes(c) })
+		start = max(end-limit, 0)
+	}
+
+	page := timelinePage{Items: items[start:end]}
+	if end < len(items) && end > 0 {
+		page.Older = cursorOf(items[end-1]).String()
+	}
+	if start > 0 && start < len(items) {
+		page.Newer = cursorOf(items[start]).String()
+	}
+	return page, nil
+}
+
+// requestedPage is the page of the user's timeline the request
+// asks for with ?before= or ?after=, and any filters
+func (s *Site) requestedPage(r *http.Request, username string, limit int) (timelinePage, error) {
+	filters, err := s.itemFilters(r)
+	if err != nil {
+		return timelinePage{}, err
+	}
+	return paginate(s.timeline(username, filters...), r.FormValue("before"), r.FormValue("after"), limit)
+}
+
+// pageLink is the request's path & query, moved to another page
+// of the timeline by setting param (before or after) to c
+func pageLink(r *http.Request, param string, c string) string {
+	q := r.URL.Query()
+	q.Del("before")
+	q.Del("after")
+	q.Set(param, c)
+	return r.URL.Path + "?" + q.Encode()
+}
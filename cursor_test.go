@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"git.j3s.sh/vore/reaper"
+	"git.j3s.sh/vore/rss"
+)
+
+// testTimeline makes n items, two to a timestamp, in timeline order
+func testTimeline(n int) []*rss.Item {
+	start := time.Date(2024, 4, 20, 0, 0, 0, 0, time.UTC)
+	var items []*rss.Item
+	for i := 0; i < n; i++ {
+		items = append(items, &rss.Item{
+			Title: fmt.Sprintf("post %d", i),
+			Link:  fmt.Sprintf("https://blog.example/%d", i),
+			Date:  start.Add(-time.Duration(i/2) * time.Hour),
+		})
+	}
+	sort.Slice(items, func(a, b int) bool { return reaper.Precedes(items[a], items[b]) })
+	return items
+}
+
+func titles(items []*rss.Item) string {
+	var result []string
+	for _, i := range items {
+		result = append(result, i.Title)
+	}
+	return strings.Join(result, ",")
+}
+
+func TestPaginate(t *testing.T) {
+	items := testTimeline(7)
+
+	page, err := paginate(items, "", "", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if titles(page.Items) != "post 0,post 1,post 2" || page.Newer != "" || page.Older == "" {
+		t.Fatalf("first page: got %+v", page)
+	}
+
+	// new items arriving doesn't shift what the cursor points at
+	newer := &rss.Item{Title: "brand new", Link: "https://blog.example/new", Date: items[0].Date.Add(time.Hour)}
+	grown := append([]*rss.Item{newer}, items...)
+	page, err = paginate(grown, page.Older, "", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if titles(page.Items) != "post 3,post 4,post 5" || page.Newer == "" || page.Older == "" {
+		t.Fatalf("second page: got %+v", page)
+	}
+	last, err := paginate(grown, page.Older, "", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if titles(last.Items) != "post 6" || last.Older != "" {
+		t.Fatalf("last page: got %+v", last)
+	}
+
+	// and back the other way
+	back, err := paginate(grown, "", page.Newer, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if titles(back.Items) != "post 0,post 1,post 2" || back.Newer == "" {
+		t.Fatalf("newer page: got %+v", back)
+	}
+	back, err = paginate(grown, "", back.Newer, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if titles(back.Items) != "brand new" || back.Newer != "" {
+		t.Fatalf("newest page: got %+v", back)
+	}
+
+	for _, c := range []string{"nope!", cursor{}.String()[:2], "bm9wZQ"} {
+		if _, err := paginate(items, c, "", 3); err == nil {
+			t.Errorf("%q: bad cursors should be an error", c)
+		}
+	}
+	if _, err := paginate(items, page.Older, page.Newer, 3); err == nil {
+		t.Error("before & after together should be an error")
+	}
+}
+
+func TestPaginateUndatedItems(t *testing.T) {
+	// feeds don't always date their items, those have the zero
+	// time and sort after everything else
+	items := testTimeline(5)
+	for i := 0; i < 4; i++ {
+		items = append(items, &rss.Item{Title: fmt.Sprintf("undated %d", i), Link: fmt.Sprintf("https://blog.example/undated/%d", i)})
+	}
+	sort.Slice(items, func(a, b int) bool { return reaper.Precedes(items[a], items[b]) })
+
+	walk := func(next func(timelinePage) (string, string)) map[string]int {
+		seen := make(map[string]int)
+		before, after := "", ""
+		if next != nil {
+			// start from the far end
+			before, after = "", cursorOf(items[len(items)-1]).String()
+			seen[items[len(items)-1].Title]++
+		}
+		// a cursor that doesn't survive the round trip
+		// pages forever, give up well before that
+		for range len(items) + 1 {
+			page, err := paginate(items, before, after, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, i := range page.Items {
+				seen[i.Title]++
+			}
+			if next == nil {
+				before = page.Older
+			} else {
+				before, after = next(page)
+			}
+			if before == "" && after == "" {
+				return seen
+			}
+		}
+		t.Fatalf("paging never ended, seen %v", seen)
+		return nil
+	}
+	newer := func(p timelinePage) (string, string) { return "", p.Newer }
+
+	for name, seen := range map[string]map[string]int{"older": walk(nil), "newer": walk(newer)} {
+		if len(seen) != len(items) {
+			t.Errorf("%s: got %d items, want %d: %v", name, len(seen), len(items), seen)
+		}
+		for title, n := range seen {
+			if n != 1 {
+				t.Errorf("%s: %s came up %d times", name, title, n)
+			}
+		}
+	}
+}
+
+var olderRe = regexp.MustCompile(`href="/jes\?before=([^"]+)"`)
+
+func TestHomepagePages(t *testing.T) {
+	_, h := newTestSite(t)
+	feed := newBigFeedServer(t, timelinePageSize+5)
+	session := register(t, h, "jes", "correct horse")
+	do(h, "POST", "/settings/submit", url.Values{"submit": {feed.URL}}, session)
+
+	w := do(h, "GET", "/jes", nil)
+	body := w.Body.String()
+	if n := strings.Count(body, "<li>"); n != timelinePageSize {
+		t.Fatalf("got %d items, want %d", n, timelinePageSize)
+	}
+	if strings.Contains(body, "?after=") {
+		t.Fatal("the first page has nothing newer")
+	}
+	m := olderRe.FindStringSubmatch(body)
+	if m == nil {
+		t.Fatalf("missing older link:\n%s", body)
+	}
+
+	w = do(h, "GET", "/jes?before="+m[1], nil)
+	body = w.Body.String()
+	if n := strings.Count(body, "<li>"); n != 5 {
+		t.Fatalf("got %d items on the last page, want 5", n)
+	}
+	if strings.Contains(body, "?before=") || !strings.Contains(body, "?after=") {
+		t.Fatalf("the last page links newer, not older:\n%s", body)
+	}
+
+	w = textDo(h, "/jes.txt?before="+m[1], "")
+	if !strings.Contains(w.Body.String(), "newer:  /jes.txt?after=") {
+		t.Fatalf("plain text should link pages too:\n%s", w.Body)
+	}
+
+	if w := do(h, "GET", "/jes?before=garbage", nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("bad cursor: got status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
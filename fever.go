@@ -0,0 +1,392 @@
+package main
+
+import (
+	"cmp"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.j3s.sh/vore/lib"
+)
+
+// the fever api, as spoken by reeder, netnewswire & friends:
+// https://web.archive.org/web/2023/https://feedafever.com/api
+//
+// clients ask for things by adding flags to the query string
+// (?api&feeds&items&since_id=10) and authenticate with api_key,
+// md5(email:password), in the form body. vore never knows anybody's
+// password, so clients log in with a username and an api token.
+const (
+	feverPath       = "/fever/"
+	feverAPIVersion = 3
+	// how many items a client gets per request, as fever did
+	feverPageSize = 50
+	// fever clients expect every feed to be in a group,
+	// vore puts them all in one
+	feverGroupID = 1
+)
+
+// feverKey is the api_key a fever client sends
+// when logging in with the token as a password
+func feverKey(username string, token string) string {
+	sum := md5.Sum([]byte(username + ":" + token))
+	return hex.EncodeToString(sum[:])
+}
+
+type feverGroup struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+}
+
+type feverFeedsGroup struct {
+	GroupID int    `json:"group_id"`
+	FeedIDs string `json:"feed_ids"`
+}
+
+type feverFeed struct {
+	ID                int    `json:"id"`
+	FaviconID         int    `json:"favicon_id"`
+	Title             string `json:"title"`
+	URL               string `json:"url"`
+	SiteURL           string `json:"site_url"`
+	IsSpark           int    `json:"is_spark"`
+	LastUpdatedOnTime int64  `json:"last_updated_on_time"`
+}
+
+type feverItem struct {
+	ID            int64  `json:"id"`
+	FeedID        int    `json:"feed_id"`
+	Title         string `json:"title"`
+	Author        string `json:"author"`
+	HTML          string `json:"html"`
+	URL           string `json:"url"`
+	IsSaved       int    `json:"is_saved"`
+	IsRead        int    `json:"is_read"`
+	CreatedOnTime int64  `json:"created_on_time"`
+}
+
+// feverBool is how fever writes booleans
+func feverBool(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// feverTimeline is the user's timeline as fever sees it,
+// items in the order they were numbered
+type feverTimeline struct {
+	feeds []feverFeed
+	items []feverItem
+}
+
+// feverTimeline numbers every item in the user's timeline,
+// and works out which ones they've read & saved
+func (s *Site) feverTimeline(username string) (feverTimeline, error) {
+	var tl feverTimeline
+	type entry struct {
+		id   string
+		item feverItem
+		date time.Time
+	}
+	var entries []entry
+	feedIDs := s.db.GetUserFeedIDs(username)
+	for _, f := range s.reaper.GetUserFeeds(username) {
+		feedID := feedIDs[f.UpdateURL]
+		feed := feverFeed{
+			ID:      feedID,
+			Title:   f.Title,
+			URL:     f.UpdateURL,
+			SiteURL: f.Link,
+		}
+		for _, i := range s.reaper.TrimFuturePosts(f.Items) {
+			feed.LastUpdatedOnTime = max(feed.LastUpdatedOnTime, i.Date.Unix())
+			entries = append(entries, entry{
+				id:   itemID(i),
+				date: i.Date,
+				item: feverItem{
+					FeedID:        feedID,
+					Title:         i.Title,
+					HTML:          i.Summary,
+					URL:           i.Link,
+					CreatedOnTime: i.Date.Unix(),
+				},
+			})
+		}
+		tl.feeds = append(tl.feeds, feed)
+	}
+
+	// oldest first, so that new items get bigger numbers
+	// and since_id finds them
+	slices.SortStableFunc(entries, func(a, b entry) int {
+		return a.date.Compare(b.date)
+	})
+	var guids []string
+	for _, e := range entries {
+		guids = append(guids, e.id)
+	}
+	ids, err := s.db.NumberItems(guids)
+	if err != nil {
+		return tl, err
+	}
+
+	read := s.db.GetReadItems(username)
+	saved := make(map[string]bool)
+	for _, si := range s.db.GetUserSavedItems(username) {
+		saved[si.ItemURL] = true
+	}
+	seen := make(map[int64]bool)
+	for _, e := range entries {
+		item := e.item
+		item.ID = ids[e.id]
+		// the same post can turn up in more than one feed
+		if seen[item.ID] {
+			continue
+		}
+		seen[item.ID] = true
+		item.IsRead = feverBool(read[item.ID])
+		item.IsSaved = feverBool(saved[item.URL])
+		tl.items = append(tl.items, item)
+	}
+	slices.SortFunc(tl.items, func(a, b feverItem) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return tl, nil
+}
+
+// feverHandler answers every fever request. fever has no errors
+// to speak of, clients only look at auth, so anything that can't
+// be made sense of is ignored.
+func (s *Site) feverHandler(w http.ResponseWriter, r *http.Request) {
+	resp := map[string]any{
+		"api_version": feverAPIVersion,
+		"auth":        0,
+	}
+	err := r.ParseForm()
+	if err != nil {
+		s.writeJSON(w, resp, http.StatusOK)
+		return
+	}
+	key := strings.ToLower(r.PostFormValue("api_key"))
+	t, ok := s.db.GetAPITokenByFeverKey(lib.HashToken(key))
+	if key == "" || !ok {
+		s.writeJSON(w, resp, http.StatusOK)
+		return
+	}
+	err = s.touchAPIToken(t)
+	if err != nil {
+		s.apiErr(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp["auth"] = 1
+	resp["last_refreshed_on_time"] = 0
+	if last := s.reaper.Stats().LastRefresh; !last.IsZero() {
+		resp["last_refreshed_on_time"] = last.Unix()
+	}
+
+	has := func(flag string) bool {
+		_, ok := r.Form[flag]
+		return ok
+	}
+	tl, err := s.feverTimeline(t.Username)
+	if err != nil {
+		s.apiErr(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if has("mark") {
+		err = s.feverMark(t.Username, t.Scope, tl, r.Form)
+		if errors.Is(err, errArchive) {
+			log.Println(err)
+			s.apiErr(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		if err != nil {
+			s.apiErr(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if has("groups") || has("feeds") {
+		var feedIDs []string
+		for _, f := range tl.feeds {
+			feedIDs = append(feedIDs, strconv.Itoa(f.ID))
+		}
+		resp["feeds_groups"] = []feverFeedsGroup{{
+			GroupID: feverGroupID,
+			FeedIDs: strings.Join(feedIDs, ","),
+		}}
+	}
+	if has("groups") {
+		resp["groups"] = []feverGroup{{ID: feverGroupID, Title: "all"}}
+	}
+	if has("feeds") {
+		resp["feeds"] = append([]feverFeed{}, tl.feeds...)
+	}
+	if has("favicons") {
+		resp["favicons"] = []any{}
+	}
+	if has("links") {
+		resp["links"] = []any{}
+	}
+	if has("items") {
+		resp["items"] = feverPage(tl.items, r.Form)
+		resp["total_items"] = len(tl.items)
+	}
+	if has("unread_item_ids") || r.Form.Get("as") == "read" || r.Form.Get("as") == "unread" {
+		resp["unread_item_ids"] = feverIDs(tl.items, func(i feverItem) bool { return i.IsRead == 0 })
+	}
+	if has("saved_item_ids") || r.Form.Get("as") == "saved" || r.Form.Get("as") == "unsaved" {
+		resp["saved_item_ids"] = feverIDs(tl.items, func(i feverItem) bool { return i.IsSaved == 1 })
+	}
+	s.writeJSON(w, resp, http.StatusOK)
+}
+
+// feverPage picks which items a request for items gets: the ones
+// listed in with_ids, the ones just before max_id, or else the
+// ones just after since_id
+func feverPage(items []feverItem, form url.Values) []feverItem {
+	page := []feverItem{}
+	if withIDs := form.Get("with_ids"); withIDs != "" {
+		for _, raw := range strings.Split(withIDs, ",") {
+			id, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+			if err != nil {
+				continue
+			}
+			i, ok := slices.BinarySearchFunc(items, id, func(item feverItem, id int64) int {
+				return cmp.Compare(item.ID, id)
+			})
+			if ok && len(page) < feverPageSize {
+				page = append(page, items[i])
+			}
+		}
+		return page
+	}
+
+	if form.Has("max_id") {
+		maxID, _ := strconv.ParseInt(form.Get("max_id"), 10, 64)
+		for i := len(items) - 1; i >= 0 && len(page) < feverPageSize; i-- {
+			if items[i].ID < maxID {
+				page = append(page, items[i])
+			}
+		}
+		return page
+	}
+
+	sinceID, _ := strconv.ParseInt(form.Get("since_id"), 10, 64)
+	for _, item := range items {
+		if len(page) == feverPageSize {
+			break
+		}
+		if item.ID > sinceID {
+			page = append(page, item)
+		}
+	}
+	return page
+}
+
+// feverIDs lists the ids of the items that match, comma separated
+func feverIDs(items []feverItem, match func(feverItem) bool) string {
+	var ids []string
+	for _, i := range items {
+		if match(i) {
+			ids = append(ids, strconv.FormatInt(i.ID, 10))
+		}
+	}
+	return strings.Join(ids, ",")
+}
+
+// feverMark handles mark=item, mark=feed & mark=group. marking
+// anything, read or saved, needs a write token: read tokens only
+// look. the items in tl are updated to match, so the response
+// doesn't need a fresh timeline.
+func (s *Site) feverMark(username string, scope string, tl feverTimeline, form url.Values) error {
+	if scope != scopeWrite {
+		return nil
+	}
+	id, err := strconv.ParseInt(form.Get("id"), 10, 64)
+	if err != nil {
+		return nil
+	}
+	as := form.Get("as")
+
+	switch form.Get("mark") {
+	case "item":
+		i := slices.IndexFunc(tl.items, func(item feverItem) bool { return item.ID == id })
+		if i == -1 {
+			return nil
+		}
+		item := tl.items[i]
+		switch as {
+		case "read", "unread":
+			err = s.db.SetItemsRead(username, []int64{id}, as == "read")
+			if err != nil {
+				return err
+			}
+			tl.items[i].IsRead = feverBool(as == "read")
+		case "saved":
+			if item.IsSaved == 1 {
+				return nil
+			}
+			_, err = s.save(username, item.URL)
+			if errors.Is(err, errItemNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			tl.setSaved(item.URL, true)
+		case "unsaved":
+			err = s.db.DeleteSavedItem(username, item.URL)
+			if err != nil {
+				return err
+			}
+			tl.setSaved(item.URL, false)
+		}
+	case "feed", "group":
+		if as != "read" {
+			return nil
+		}
+		// before keeps items that arrived after the client
+		// last synced from being marked as read
+		before, err := strconv.ParseInt(form.Get("before"), 10, 64)
+		if err != nil {
+			before = time.Now().Unix()
+		}
+		var ids []int64
+		var marked []int
+		for i, item := range tl.items {
+			if form.Get("mark") == "feed" && item.FeedID != int(id) {
+				continue
+			}
+			if item.IsRead == 0 && item.CreatedOnTime < before {
+				ids = append(ids, item.ID)
+				marked = append(marked, i)
+			}
+		}
+		err = s.db.SetItemsRead(username, ids, true)
+		if err != nil {
+			return err
+		}
+		for _, i := range marked {
+			tl.items[i].IsRead = 1
+		}
+	}
+	return nil
+}
+
+// setSaved marks every item linking to url as saved or not,
+// saves being kept by url
+func (tl feverTimeline) setSaved(url string, saved bool) {
+	for i := range tl.items {
+		if tl.items[i].URL == url {
+			tl.items[i].IsSaved = feverBool(saved)
+		}
+	}
+}
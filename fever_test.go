@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"git.j3s.sh/vore/lib"
+)
+
+// feverToken is the password the fixtures were made with,
+// their api_key is feverKey("jes", feverToken)
+const feverToken = "vore_5eed5eed5eed5eed5eed5eed5eed5eed5eed5eed5eed5eed5eed5eed5eed5eed"
+
+// feverResponse is the bits of a fever response the tests look at
+type feverResponse struct {
+	APIVersion    int               `json:"api_version"`
+	Auth          int               `json:"auth"`
+	Groups        []feverGroup      `json:"groups"`
+	FeedsGroups   []feverFeedsGroup `json:"feeds_groups"`
+	Feeds         []feverFeed       `json:"feeds"`
+	Favicons      []any             `json:"favicons"`
+	Items         []feverItem       `json:"items"`
+	TotalItems    int               `json:"total_items"`
+	UnreadItemIDs *string           `json:"unread_item_ids"`
+	SavedItemIDs  *string           `json:"saved_item_ids"`
+}
+
+func itemIDs(items []feverItem) string {
+	return feverIDs(items, func(feverItem) bool { return true })
+}
+
+// TestFeverFixtures replays requests the way fever clients send
+// them, in order, against a user subscribed to a five item feed.
+// items are numbered oldest first, so "post 0" is item 5.
+func TestFeverFixtures(t *testing.T) {
+	s, h := newTestSite(t)
+	s.archiver = fakeArchiver{}
+	feed := newBigFeedServer(t, 5)
+	session := register(t, h, "jes", "correct horse")
+	token := newAPIToken(t, h, session, scopeWrite)
+	apiDo(h, "POST", "/api/v1/subscriptions", token, `{"url": "`+feed.URL+`"}`)
+	err := s.db.CreateAPIToken("jes", "reeder", lib.HashToken(feverToken), lib.HashToken(feverKey("jes", feverToken)), scopeWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checks := map[string]func(t *testing.T, resp feverResponse){
+		"01_reeder_auth": func(t *testing.T, resp feverResponse) {
+			if resp.Auth != 1 || resp.APIVersion != feverAPIVersion {
+				t.Fatalf("got auth %d, version %d", resp.Auth, resp.APIVersion)
+			}
+		},
+		"02_reeder_bad_key": func(t *testing.T, resp feverResponse) {
+			if resp.Auth != 0 {
+				t.Fatal("wrong key should not authenticate")
+			}
+			if resp.UnreadItemIDs != nil || resp.Items != nil {
+				t.Fatal("unauthenticated response should be empty")
+			}
+		},
+		"03_reeder_groups": func(t *testing.T, resp feverResponse) {
+			if len(resp.Groups) != 1 || len(resp.FeedsGroups) != 1 || resp.FeedsGroups[0].FeedIDs != "1" {
+				t.Fatalf("got groups %+v, feeds_groups %+v", resp.Groups, resp.FeedsGroups)
+			}
+		},
+		"04_reeder_feeds": func(t *testing.T, resp feverResponse) {
+			if len(resp.Feeds) != 1 || resp.Feeds[0].Title != "big feed" || resp.Feeds[0].URL != feed.URL {
+				t.Fatalf("got feeds %+v", resp.Feeds)
+			}
+		},
+		"05_reeder_favicons": func(t *testing.T, resp feverResponse) {
+			if resp.Favicons == nil {
+				t.Fatal("favicons should be an empty list")
+			}
+		},
+		"06_reeder_unread_item_ids": func(t *testing.T, resp feverResponse) {
+			if got := str(resp.UnreadItemIDs); got != "1,2,3,4,5" {
+				t.Fatalf("got unread %s", got)
+			}
+		},
+		"07_reeder_saved_item_ids": func(t *testing.T, resp feverResponse) {
+			if got := str(resp.SavedItemIDs); got != "" {
+				t.Fatalf("got saved %s", got)
+			}
+		},
+		"08_reeder_items_since": func(t *testing.T, resp feverResponse) {
+			if got := itemIDs(resp.Items); got != "4,5" || resp.TotalItems != 5 {
+				t.Fatalf("got items %s of %d", got, resp.TotalItems)
+			}
+			if newest := resp.Items[1]; newest.Title != "post 0" || newest.URL != "https://blog.example/0" || newest.FeedID != 1 {
+				t.Fatalf("got item %+v", newest)
+			}
+		},
+		"09_unread_items_max": func(t *testing.T, resp feverResponse) {
+			if got := itemIDs(resp.Items); got != "2,1" {
+				t.Fatalf("got items %s", got)
+			}
+		},
+		"10_unread_items_with_ids": func(t *testing.T, resp feverResponse) {
+			if got := itemIDs(resp.Items); got != "5,1" {
+				t.Fatalf("got items %s", got)
+			}
+		},
+		"11_reeder_mark_item_read": func(t *testing.T, resp feverResponse) {
+			if got := str(resp.UnreadItemIDs); got != "1,2,3,4" {
+				t.Fatalf("got unread %s", got)
+			}
+		},
+		"12_reeder_mark_item_saved": func(t *testing.T, resp feverResponse) {
+			if got := str(resp.SavedItemIDs); got != "5" {
+				t.Fatalf("got saved %s", got)
+			}
+			if saves := s.db.GetUserSavedItems("jes"); len(saves) != 1 || saves[0].ItemURL != "https://blog.example/0" {
+				t.Fatalf("starring should save, got %+v", saves)
+			}
+		},
+		"13_reeder_mark_item_unsaved": func(t *testing.T, resp feverResponse) {
+			if got := str(resp.SavedItemIDs); got != "" {
+				t.Fatalf("got saved %s", got)
+			}
+			if saves := s.db.GetUserSavedItems("jes"); len(saves) != 0 {
+				t.Fatalf("unstarring should unsave, got %+v", saves)
+			}
+		},
+		"14_unread_mark_feed_read": func(t *testing.T, resp feverResponse) {
+			if got := str(resp.UnreadItemIDs); got != "" {
+				t.Fatalf("got unread %s", got)
+			}
+		},
+	}
+
+	fixtures, err := filepath.Glob("testdata/fever/*.http")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) != len(checks) {
+		t.Fatalf("got %d fixtures and %d checks", len(fixtures), len(checks))
+	}
+	for _, path := range fixtures {
+		name := strings.TrimSuffix(filepath.Base(path), ".http")
+		check, ok := checks[name]
+		if !ok {
+			t.Fatalf("no check for fixture %s", name)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, err := http.ReadRequest(bufio.NewReader(f))
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		f.Close()
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: got status %d: %s", name, w.Code, w.Body)
+		}
+		var resp feverResponse
+		err = json.Unmarshal(w.Body.Bytes(), &resp)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		t.Run(name, func(t *testing.T) { check(t, resp) })
+	}
+}
+
+func TestFeverReadOnlyToken(t *testing.T) {
+	s, h := newTestSite(t)
+	s.archiver = fakeArchiver{}
+	feed := newFeedServer(t)
+	session := register(t, h, "jes", "correct horse")
+	token := newAPIToken(t, h, session, scopeWrite)
+	apiDo(h, "POST", "/api/v1/subscriptions", token, `{"url": "`+feed.URL+`"}`)
+	read := newAPIToken(t, h, session, scopeRead)
+
+	fever := func(query string, body string) feverResponse {
+		req := httptest.NewRequest("POST", feverPath+"?"+query, strings.NewReader("api_key="+feverKey("jes", read)+body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		var resp feverResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("got status %d: %s", w.Code, w.Body)
+		}
+		return resp
+	}
+
+	// tokens made through the settings page work as fever passwords
+	if resp := fever("api&unread_item_ids", ""); resp.Auth != 1 || str(resp.UnreadItemIDs) != "1" {
+		t.Fatalf("got %+v", resp)
+	}
+	if resp := fever("api", "&mark=item&as=read&id=1"); str(resp.UnreadItemIDs) != "1" {
+		t.Fatal("read tokens should not be able to mark items read")
+	}
+	if resp := fever("api", "&mark=group&as=read&id=0"); str(resp.UnreadItemIDs) != "1" {
+		t.Fatal("read tokens should not be able to mark everything read")
+	}
+	if resp := fever("api", "&mark=item&as=saved&id=1"); str(resp.SavedItemIDs) != "" {
+		t.Fatal("read tokens should not be able to save items")
+	}
+}
+
+// str shows a missing id list as such, rather than as no ids
+func str(p *string) string {
+	if p == nil {
+		return "<missing>"
+	}
+	return *p
+}
@@ -0,0 +1,44 @@
+// vore works without javascript, this file only adds niceties.
+// it lives here rather than inline so that the content security
+// policy can forbid inline scripts.
+
+if ('serviceWorker' in navigator) {
+  navigator.serviceWorker.register("/static/serviceworker.js");
+}
+
+// save posts in the background instead of leaving the page
+function saveItem(form) {
+  const element = form.querySelector("button");
+  element.disabled = true;
+  const states = [".", "..", "..."];
+  let index = 0;
+
+  const intervalId = setInterval(() => {
+    element.textContent = "saving" + states[index];
+    index = (index + 1) % states.length;
+  }, 300);
+
+  fetch(form.action, { method: "POST", body: new FormData(form) })
+    .then(response => {
+      if (!response.ok) {
+        throw new Error(`Request failed with status ${response.status}`);
+      }
+      return response.text();
+    })
+    .then(data => {
+      clearInterval(intervalId);
+      element.textContent = "saved!";
+    })
+    .catch(error => {
+      console.error(error);
+      clearInterval(intervalId);
+      element.textContent = "error!";
+    });
+}
+
+document.addEventListener("submit", event => {
+  if (event.target.matches("form.save")) {
+    event.preventDefault();
+    saveItem(event.target);
+  }
+});
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"git.j3s.sh/vore/reaper"
+)
+
+// filterParams are the query parameters that narrow a timeline
+var filterParams = []string{"feed", "domain", "since", "until", "q"}
+
+// itemFilters turns the request's ?feed=, ?domain=, ?since=,
+// ?until= & ?q= into reaper filters. dates are either a day
+// (2006-01-02), which until includes, or an rfc 3339 time.
+func (s *Site) itemFilters(r *http.Request) ([]reaper.ItemFilter, error) {
+	var filters []reaper.ItemFilter
+	if feed := strings.TrimSpace(r.FormValue("feed")); feed != "" {
+		filters = append(filters, s.reaper.FromFeed(feed))
+	}
+	if domain := strings.TrimSpace(r.FormValue("domain")); domain != "" {
+		filters = append(filters, reaper.FromDomain(domain))
+	}
+	if since := r.FormValue("since"); since != "" {
+		t, _, err := parseFilterDate("since", since)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, reaper.Since(t))
+	}
+	if until := r.FormValue("until"); until != "" {
+		t, day, err := parseFilterDate("until", until)
+		if err != nil {
+			return nil, err
+		}
+		if day {
+			// the whole day, not just its first moment
+			t = t.AddDate(0, 0, 1)
+		}
+		filters = append(filters, reaper.Until(t))
+	}
+	if q := strings.TrimSpace(r.FormValue("q")); q != "" {
+		filters = append(filters, reaper.TitleContains(q))
+	}
+	return filters, nil
+}
+
+// parseFilterDate reports whether value was a day, rather than a time
+func parseFilterDate(field string, value string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, true, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+	return time.Time{}, false, fmt.Errorf("%s must be a date like 2006-01-02, or an rfc 3339 time", field)
+}
+
+// filtered reports whether the request narrows the timeline down
+func filtered(r *http.Request) bool {
+	for _, p := range filterParams {
+		if r.FormValue(p) != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestHomepageFilters(t *testing.T) {
+	_, h := newTestSite(t)
+	small, big := newFeedServer(t), newBigFeedServer(t, 3)
+	session := register(t, h, "jes", "correct horse")
+	do(h, "POST", "/settings/submit", url.Values{"submit": {small.URL + "\r\n" + big.URL}}, session)
+
+	const hello = "hello from the test feed"
+	for _, tc := range []struct {
+		query string
+		want  []string
+		not   []string
+	}{
+		{"", []string{hello, "post 0", "post 2"}, []string{"show everything"}},
+		{"feed=" + url.QueryEscape(big.URL), []string{"post 0", "post 2", "show everything"}, []string{hello}},
+		{"domain=blog.example", []string{hello, "post 0"}, nil},
+		{"domain=nope.example", []string{"nothing matches"}, []string{hello, "post 0"}},
+		{"since=2006-01-28", []string{"post 0", "post 2"}, []string{hello}},
+		{"until=2006-01-02", []string{hello}, []string{"post 0"}},
+		{"since=2006-01-28T14:00:00Z", []string{"post 0", "post 1"}, []string{hello, "post 2"}},
+		{"q=POST+1", []string{"post 1"}, []string{hello, "post 0", "post 2"}},
+		{"q=post&until=2006-01-28T14:00:00Z", []string{"post 2"}, []string{hello, "post 0", "post 1"}},
+	} {
+		w := do(h, "GET", "/jes?"+tc.query, nil)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: got status %d: %s", tc.query, w.Code, w.Body)
+			continue
+		}
+		body := w.Body.String()
+		for _, want := range tc.want {
+			if !strings.Contains(body, want) {
+				t.Errorf("%s: missing %q", tc.query, want)
+			}
+		}
+		for _, not := range tc.not {
+			if strings.Contains(body, not) {
+				t.Errorf("%s: shouldn't have %q", tc.query, not)
+			}
+		}
+	}
+
+	for _, q := range []string{"since=yesterday", "until=2006-13-01"} {
+		if w := do(h, "GET", "/jes?"+q, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want %d", q, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestFiltersSurvivePaging(t *testing.T) {
+	_, h := newTestSite(t)
+	feed := newBigFeedServer(t, timelinePageSize+10)
+	session := register(t, h, "jes", "correct horse")
+	do(h, "POST", "/settings/submit", url.Values{"submit": {feed.URL}}, session)
+
+	// post 1 and posts 10 to 19 match
+	w := do(h, "GET", "/jes?q=post+1", nil)
+	if n := strings.Count(w.Body.String(), "<li>"); n != 11 {
+		t.Fatalf("got %d items, want 11", n)
+	}
+
+	w = do(h, "GET", "/jes?q=post", nil)
+	m := olderRe.FindStringSubmatch(w.Body.String())
+	if m == nil {
+		t.Fatalf("missing older link:\n%s", w.Body)
+	}
+	older := html.UnescapeString(m[0][len(`href="`) : len(m[0])-1])
+	if !strings.Contains(older, "q=post") {
+		t.Fatalf("the older link should keep the filter, got %s", older)
+	}
+	if n := strings.Count(do(h, "GET", older, nil).Body.String(), "<li>"); n != 10 {
+		t.Fatalf("got %d items on the second page, want 10", n)
+	}
+
+	token := newAPIToken(t, h, session, "read")
+	w = apiDo(h, "GET", "/api/v1/timeline?limit=5&domain=blog.example", token, "")
+	page := decode[apiTimeline](t, w)
+	if len(page.Items) != 5 || !strings.Contains(page.Next, "domain=blog.example") {
+		t.Fatalf("got %d items, next %q", len(page.Items), page.Next)
+	}
+	w = apiDo(h, "GET", "/api/v1/timeline?domain=nope.example", token, "")
+	if page := decode[apiTimeline](t, w); len(page.Items) != 0 || page.Next != "" {
+		t.Fatalf("got %+v", page)
+	}
+}
@@ -0,0 +1,127 @@
+// Package finger is a finger server, enough of one to answer
+// questions about users.
+//
+// https://www.rfc-editor.org/rfc/rfc1288
+package finger
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// DefaultPort is where finger servers listen unless told otherwise.
+const DefaultPort = 79
+
+const (
+	// queries are a username & a couple of switches, anything
+	// longer than this isn't a query
+	maxQueryLength = 512
+	// how long a client has to send its query
+	// and read the answer
+	connTimeout = 30 * time.Second
+)
+
+// Query is a finger query.
+type Query struct {
+	// User is who's being fingered, empty when the
+	// client wants to know who's around
+	User string
+	// Verbose is set by the /W switch
+	Verbose bool
+}
+
+// Handler answers finger queries. answers are plain text, and
+// \n is turned into the \r\n the protocol wants.
+type Handler interface {
+	ServeFinger(w io.Writer, q *Query)
+}
+
+// HandlerFunc lets an ordinary function be a Handler.
+type HandlerFunc func(w io.Writer, q *Query)
+
+// ServeFinger calls f(w, q).
+func (f HandlerFunc) ServeFinger(w io.Writer, q *Query) {
+	f(w, q)
+}
+
+// Serve answers every connection on l with h, until l is closed.
+func Serve(l net.Listener, h Handler) error {
+	for {
+		conn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		go serveConn(conn, h)
+	}
+}
+
+func serveConn(conn net.Conn, h Handler) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(connTimeout))
+
+	// the answer is written in one go once it's ready,
+	// handlers don't have to care about the connection
+	var buf bytes.Buffer
+	// like net/http, a panicking handler only
+	// takes its own connection down with it
+	defer func() {
+		if err := recover(); err != nil {
+			log.Printf("finger: panic serving %s: %v\n%s", conn.RemoteAddr(), err, debug.Stack())
+			io.WriteString(conn, "finger: something broke, sorry\r\n")
+		}
+	}()
+	q, err := readQuery(conn)
+	if err != nil {
+		buf.WriteString("finger: " + err.Error() + "\n")
+	} else {
+		h.ServeFinger(&buf, q)
+	}
+	_, err = strings.NewReplacer("\r\n", "\r\n", "\n", "\r\n").WriteString(conn, buf.String())
+	if err != nil {
+		log.Printf("finger: %s\n", err)
+	}
+}
+
+// readQuery reads & parses the query line, which is
+// {Q1} ::= [{W}|{W}{S}{U}]{C}, or a forwarding request
+// that gets turned down
+func readQuery(conn net.Conn) (*Query, error) {
+	// +2 for the \r\n
+	line, err := bufio.NewReaderSize(io.LimitReader(conn, maxQueryLength+2), maxQueryLength+2).ReadString('\n')
+	if err != nil {
+		return nil, errors.New("query too long or cut off")
+	}
+	// plenty of clients only send \n
+	line = strings.TrimRight(line, "\r\n")
+
+	q := &Query{}
+	fields := strings.Fields(line)
+	if len(fields) > 0 && strings.EqualFold(fields[0], "/W") {
+		q.Verbose = true
+		fields = fields[1:]
+	}
+	switch len(fields) {
+	case 0:
+		return q, nil
+	case 1:
+	default:
+		return nil, errors.New("one user at a time please")
+	}
+	// relaying queries on to other hosts is a
+	// security hole, rfc 1288 says to refuse
+	if strings.Contains(fields[0], "@") {
+		return nil, errors.New("forwarding refused")
+	}
+	q.User = fields[0]
+	return q, nil
+}
@@ -0,0 +1,79 @@
+package finger
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// serve starts a server for h on a random port
+func serve(t *testing.T, h Handler) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go Serve(l, h)
+	return l.Addr().String()
+}
+
+// send writes a raw query and returns the whole answer
+func send(t *testing.T, addr string, query string) string {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = io.WriteString(conn, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	answer, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(answer)
+}
+
+func TestServe(t *testing.T) {
+	addr := serve(t, HandlerFunc(func(w io.Writer, q *Query) {
+		fmt.Fprintf(w, "user=%q\nverbose=%v\n", q.User, q.Verbose)
+	}))
+
+	for query, want := range map[string]string{
+		"jes\r\n":                             "user=\"jes\"\r\nverbose=false\r\n",
+		"jes\n":                               "user=\"jes\"\r\nverbose=false\r\n",
+		"/W jes\r\n":                          "user=\"jes\"\r\nverbose=true\r\n",
+		"/w\r\n":                              "user=\"\"\r\nverbose=true\r\n",
+		"\r\n":                                "user=\"\"\r\nverbose=false\r\n",
+		"jes@elsewhere\r\n":                   "finger: forwarding refused\r\n",
+		"jes bob\r\n":                         "finger: one user at a time please\r\n",
+		strings.Repeat("a", maxQueryLength+2): "finger: query too long or cut off\r\n",
+	} {
+		if got := send(t, addr, query); got != want {
+			t.Errorf("%q: got %q, want %q", query, got, want)
+		}
+	}
+}
+
+func TestServePanic(t *testing.T) {
+	addr := serve(t, HandlerFunc(func(w io.Writer, q *Query) {
+		if q.User == "boom" {
+			fmt.Fprintln(w, "half an answer")
+			panic("boom")
+		}
+		fmt.Fprintln(w, "fine")
+	}))
+
+	if got := send(t, addr, "boom\r\n"); got != "finger: something broke, sorry\r\n" {
+		t.Errorf("panicking handler: got %q", got)
+	}
+	// the server is still up
+	if got := send(t, addr, "jes\r\n"); got != "fine\r\n" {
+		t.Errorf("after a panic: got %q", got)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+
+	"git.j3s.sh/vore/finger"
+	"git.j3s.sh/vore/rss"
+)
+
+// fingerd answers `finger user@host` with the latest n items
+// of the user's timeline. /W lists their feeds too.
+func (s *Site) fingerd(n int) finger.Handler {
+	return finger.HandlerFunc(func(w io.Writer, q *finger.Query) {
+		if q.User == "" {
+			fmt.Fprintln(w, "vore doesn't list its users, finger somebody by name")
+			return
+		}
+		if !s.db.UserExists(q.User) {
+			fmt.Fprintf(w, "finger: %s: no such user\n", q.User)
+			return
+		}
+
+		feeds := s.reaper.GetUserFeeds(q.User)
+		items := s.timeline(q.User)
+		if len(items) > n {
+			items = items[:n]
+		}
+		data := struct {
+			User    string
+			Verbose bool
+			Feeds   []*rss.Feed
+			Items   []*rss.Item
+		}{
+			User:    q.User,
+			Verbose: q.Verbose,
+			Feeds:   feeds,
+			Items:   items,
+		}
+		// text pages expect the same wrapping as on the web
+		text, err := s.executeText("finger", struct{ Data any }{data})
+		if err != nil {
+			log.Println("finger: " + err.Error())
+			fmt.Fprintln(w, "finger: something broke, sorry")
+			return
+		}
+		w.Write(text)
+	})
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"unicode"
+
+	"git.j3s.sh/vore/finger"
+	"git.j3s.sh/vore/rss"
+)
+
+// fingerQuery starts the site's finger server and asks it query
+func fingerQuery(t *testing.T, s *Site, n int, query string) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go finger.Serve(l, s.fingerd(n))
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = io.WriteString(conn, query+"\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	answer, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(answer)
+}
+
+func TestFingerd(t *testing.T) {
+	s, h := newTestSite(t)
+	feed := newBigFeedServer(t, 5)
+	session := register(t, h, "jes", "correct horse")
+	do(h, "POST", "/settings/submit", url.Values{"submit": {feed.URL}}, session)
+	register(t, h, "bob", "correct horse")
+
+	answer := fingerQuery(t, s, 2, "jes")
+	for _, want := range []string{"login: jes\r\n", "subscriptions: 1\r\n", "post 0", "post 1", "https://blog.example/1\r\n"} {
+		if !strings.Contains(answer, want) {
+			t.Errorf("missing %q in:\n%s", want, answer)
+		}
+	}
+	if strings.Contains(answer, "post 2") || strings.Contains(answer, feed.URL) {
+		t.Errorf("should only show the latest 2 items, and no feeds:\n%s", answer)
+	}
+
+	if answer := fingerQuery(t, s, 2, "/W jes"); !strings.Contains(answer, "big feed") || !strings.Contains(answer, feed.URL) {
+		t.Errorf("/W should list feeds:\n%s", answer)
+	}
+	if answer := fingerQuery(t, s, 2, "bob"); !strings.Contains(answer, "subscriptions: 0") || !strings.Contains(answer, "nothing here yet") {
+		t.Errorf("got:\n%s", answer)
+	}
+	if answer := fingerQuery(t, s, 2, "nobody"); answer != "finger: nobody: no such user\r\n" {
+		t.Errorf("got %q", answer)
+	}
+	if answer := fingerQuery(t, s, 2, ""); strings.Contains(answer, "jes") {
+		t.Errorf("users shouldn't be listed:\n%s", answer)
+	}
+}
+
+func TestFingerdControlCharacters(t *testing.T) {
+	s, _ := newTestSite(t)
+	// a terminal would act on these rather than print them
+	feed := &rss.Feed{
+		Title:     "evil\x1b[2J feed",
+		UpdateURL: "https://evil.example/feed\x1b]0;pwned\x07",
+	}
+	item := &rss.Item{
+		Title: "evil\x1b[31m post\u009b2J",
+		Link:  "https://evil.example/\x1b[1mpost",
+		Date:  time.Now().Add(-time.Hour),
+	}
+	data := struct {
+		User    string
+		Verbose bool
+		Feeds   []*rss.Feed
+		Items   []*rss.Item
+	}{
+		User:    "jes",
+		Verbose: true,
+		Feeds:   []*rss.Feed{feed},
+		Items:   []*rss.Item{item},
+	}
+	text, err := s.executeText("finger", struct{ Data any }{data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	answer := string(text)
+	if strings.ContainsFunc(answer, func(r rune) bool { return unicode.IsControl(r) && r != '\n' && r != '\t' }) {
+		t.Errorf("control characters got through:\n%q", answer)
+	}
+	for _, want := range []string{"evil[2J feed  https://evil.example/feed]0;pwned\n", "evil[31m post2J  evil.example  ", "  https://evil.example/[1mpost\n"} {
+		if !strings.Contains(answer, want) {
+			t.Errorf("missing %q in:\n%q", want, answer)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"git.j3s.sh/vore/gemini"
+	"git.j3s.sh/vore/lib"
+	"git.j3s.sh/vore/rss"
+)
+
+// geminiHandler serves homepages, saves & feed details to gemini
+// clients, as gemtext. the paths are the same as on the web.
+func (s *Site) geminiHandler() gemini.Handler {
+	return gemini.HandlerFunc(func(w gemini.ResponseWriter, r *gemini.Request) {
+		path := r.URL.Path
+		switch {
+		case path == "/":
+			s.renderGemtext(w, "index", nil)
+		case path == "/saves":
+			s.geminiSavesHandler(w, r)
+		case strings.HasPrefix(path, "/feeds/"):
+			s.geminiFeedDetailsHandler(w, r)
+		case strings.Count(path, "/") == 1:
+			s.geminiUserHandler(w, r, strings.TrimPrefix(path, "/"))
+		default:
+			w.WriteHeader(gemini.StatusNotFound, "not found")
+		}
+	})
+}
+
+// renderGemtext is renderPage for gemini. pages come from
+// files/*.tmpl.gmi.
+func (s *Site) renderGemtext(w gemini.ResponseWriter, page string, data any) {
+	tmplFiles := filepath.Join("files", "*.tmpl.gmi")
+	tmpl, err := template.New("whatever").Funcs(s.funcMap()).ParseGlob(tmplFiles)
+	if err != nil {
+		s.geminiErr(w, err.Error(), gemini.StatusTemporaryFailure)
+		return
+	}
+
+	pageData := struct {
+		Title string
+		Data  any
+	}{
+		Title: page,
+		Data:  data,
+	}
+	// a failed template can't take back a success header,
+	// so the page is only sent once it's complete
+	var buf bytes.Buffer
+	err = tmpl.ExecuteTemplate(&buf, page, pageData)
+	if err != nil {
+		s.geminiErr(w, err.Error(), gemini.StatusTemporaryFailure)
+		return
+	}
+	w.WriteHeader(gemini.StatusSuccess, gemini.Gemtext)
+	w.Write(buf.Bytes())
+}
+
+// geminiErr is renderErr for gemini
+func (s *Site) geminiErr(w gemini.ResponseWriter, error string, status int) {
+	if status == gemini.StatusTemporaryFailure {
+		// only server-side trouble is worth logging
+		log.Println("gemini: " + error)
+	}
+	w.WriteHeader(status, error)
+}
+
+func (s *Site) geminiUserHandler(w gemini.ResponseWriter, r *gemini.Request, username string) {
+	if !s.db.UserExists(username) {
+		s.geminiErr(w, "no such user", gemini.StatusNotFound)
+		return
+	}
+	// pages are picked like on the web, ?before= or ?after=
+	q, _ := url.ParseQuery(r.URL.RawQuery)
+	page, err := paginate(s.timeline(username), q.Get("before"), q.Get("after"), timelinePageSize)
+	if err != nil {
+		s.geminiErr(w, err.Error(), gemini.StatusBadRequest)
+		return
+	}
+	data := struct {
+		User  string
+		Items []*rss.Item
+		Older string
+		Newer string
+	}{
+		User:  username,
+		Items: page.Items,
+		Older: page.Older,
+		Newer: page.Newer,
+	}
+	s.renderGemtext(w, "user", data)
+}
+
+// geminiSavesHandler shows the saves of whoever the client
+// certificate belongs to. certificates are linked to an account
+// the first time they're used, by pasting in an api token.
+func (s *Site) geminiSavesHandler(w gemini.ResponseWriter, r *gemini.Request) {
+	if r.Certificate == nil {
+		s.geminiErr(w, "saves are private, pick a client certificate to see yours", gemini.StatusCertificateRequired)
+		return
+	}
+	fingerprint := gemini.Fingerprint(r.Certificate)
+
+	t, ok := s.db.GetGeminiCertificateToken(fingerprint)
+	if !ok {
+		if r.URL.RawQuery == "" {
+			w.WriteHeader(gemini.StatusSensitiveInput, "new certificate! paste an api token from /settings on the web to link it to your account")
+			return
+		}
+		token, err := url.QueryUnescape(r.URL.RawQuery)
+		if err != nil {
+			s.geminiErr(w, "can't decode that token", gemini.StatusBadRequest)
+			return
+		}
+		t, ok = s.db.GetAPIToken(lib.HashToken(strings.TrimSpace(token)))
+		if !ok {
+			s.geminiErr(w, "that api token didn't work", gemini.StatusCertificateNotAuthorised)
+			return
+		}
+		err = s.db.LinkGeminiCertificate(t.ID, fingerprint)
+		if err != nil {
+			s.geminiErr(w, err.Error(), gemini.StatusTemporaryFailure)
+			return
+		}
+		// get the token out of the url bar
+		w.WriteHeader(gemini.StatusRedirect, "/saves")
+		return
+	}
+	err := s.touchAPIToken(t)
+	if err != nil {
+		s.geminiErr(w, err.Error(), gemini.StatusTemporaryFailure)
+		return
+	}
+
+	data := struct {
+		User  string
+		Saves any
+	}{
+		User:  t.Username,
+		Saves: s.db.GetUserSavedItems(t.Username),
+	}
+	s.renderGemtext(w, "saves", data)
+}
+
+func (s *Site) geminiFeedDetailsHandler(w gemini.ResponseWriter, r *gemini.Request) {
+	// feed urls are escaped into a single path segment
+	encodedURL := strings.TrimPrefix(r.URL.EscapedPath(), "/feeds/")
+	feedURL, err := url.QueryUnescape(encodedURL)
+	if err != nil {
+		s.geminiErr(w, "can't decode feed url", gemini.StatusBadRequest)
+		return
+	}
+	feed := s.reaper.GetFeed(feedURL)
+	if feed == nil {
+		s.geminiErr(w, "vore doesn't know about that feed", gemini.StatusNotFound)
+		return
+	}
+	fetchErr, err := s.db.GetFeedFetchError(feedURL)
+	if err != nil {
+		s.geminiErr(w, err.Error(), gemini.StatusTemporaryFailure)
+		return
+	}
+	data := struct {
+		Feed         *rss.Feed
+		FetchFailure string
+	}{
+		Feed:         feed,
+		FetchFailure: fetchErr,
+	}
+	s.renderGemtext(w, "feedDetails", data)
+}
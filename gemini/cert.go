@@ -0,0 +1,86 @@
+package gemini
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/fs"
+	"math/big"
+	"os"
+	"time"
+)
+
+// certLifetime is how long generated certificates last. gemini
+// clients pin the certificate they first saw, so a new one makes
+// every client complain; better that it never has to change.
+const certLifetime = 20 * 365 * 24 * time.Hour
+
+// LoadOrCreateCertificate loads the certificate in certFile &
+// keyFile. if neither file exists yet, a self-signed certificate
+// for host is made and saved there first.
+func LoadOrCreateCertificate(certFile string, keyFile string, host string) (tls.Certificate, error) {
+	_, certErr := os.Stat(certFile)
+	_, keyErr := os.Stat(keyFile)
+	if errors.Is(certErr, fs.ErrNotExist) && errors.Is(keyErr, fs.ErrNotExist) {
+		err := createCertificate(certFile, keyFile, host)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+	return tls.LoadX509KeyPair(certFile, keyFile)
+}
+
+func createCertificate(certFile string, keyFile string, host string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: host},
+		DNSNames:              []string{host},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(certLifetime),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	// the key first, a certificate without its key is no use
+	err = writePEM(keyFile, "EC PRIVATE KEY", keyDER, 0600)
+	if err != nil {
+		return err
+	}
+	return writePEM(certFile, "CERTIFICATE", der, 0644)
+}
+
+func writePEM(path string, blockType string, der []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	err = pem.Encode(f, &pem.Block{Type: blockType, Bytes: der})
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,208 @@
+// Package gemini is just enough of the gemini protocol to serve
+// pages to gemini clients, over a tls listener.
+//
+// https://geminiprotocol.net/docs/protocol-specification.gmi
+package gemini
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// DefaultPort is where gemini servers listen unless told otherwise.
+const DefaultPort = 1965
+
+// status codes, as sent in the response header.
+const (
+	StatusInput                    = 10
+	StatusSensitiveInput           = 11
+	StatusSuccess                  = 20
+	StatusRedirect                 = 30
+	StatusTemporaryFailure         = 40
+	StatusPermanentFailure         = 50
+	StatusNotFound                 = 51
+	StatusProxyRequestRefused      = 53
+	StatusBadRequest               = 59
+	StatusCertificateRequired      = 60
+	StatusCertificateNotAuthorised = 61
+)
+
+// Gemtext is the media type of gemini's own markup.
+const Gemtext = "text/gemini; charset=utf-8"
+
+const (
+	// requests are a url of at most 1024 bytes, plus \r\n
+	maxRequestLength = 1024
+	// how long a client has to send its request
+	// and read the response
+	connTimeout = 30 * time.Second
+)
+
+// Request is a gemini request. there's nothing to it but a url,
+// and maybe the certificate the client identified itself with.
+type Request struct {
+	URL *url.URL
+	// Certificate is nil unless the client sent one
+	Certificate *x509.Certificate
+}
+
+// ResponseWriter writes a response: a header, then for
+// successful responses, a body.
+type ResponseWriter interface {
+	// WriteHeader sends the status & meta line. meta is the
+	// media type for successful responses, and a message for
+	// everything else.
+	WriteHeader(status int, meta string)
+	// Write sends part of the body, sending a gemtext
+	// success header first if there hasn't been one yet.
+	Write(p []byte) (int, error)
+}
+
+// Handler answers gemini requests.
+type Handler interface {
+	ServeGemini(w ResponseWriter, r *Request)
+}
+
+// HandlerFunc lets an ordinary function be a Handler.
+type HandlerFunc func(w ResponseWriter, r *Request)
+
+// ServeGemini calls f(w, r).
+func (f HandlerFunc) ServeGemini(w ResponseWriter, r *Request) {
+	f(w, r)
+}
+
+// TLSConfig is the tls config gemini wants: the server's own
+// certificate, and whatever certificate clients care to send.
+// client certificates are self-signed as a rule, so they're
+// never verified, only identified by Fingerprint.
+func TLSConfig(cert tls.Certificate) *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+		ClientAuth:   tls.RequestClientCert,
+	}
+}
+
+// Listen listens for gemini connections on addr.
+func Listen(addr string, cert tls.Certificate) (net.Listener, error) {
+	return tls.Listen("tcp", addr, TLSConfig(cert))
+}
+
+// Serve answers every connection on l with h, until l is closed.
+func Serve(l net.Listener, h Handler) error {
+	for {
+		conn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		go serveConn(conn, h)
+	}
+}
+
+// Fingerprint identifies a client certificate.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+type responseWriter struct {
+	w           io.Writer
+	wroteHeader bool
+	err         error
+}
+
+func (rw *responseWriter) WriteHeader(status int, meta string) {
+	if rw.wroteHeader {
+		return
+	}
+	rw.wroteHeader = true
+	// a header is a single line
+	meta = strings.NewReplacer("\r", "", "\n", " ").Replace(meta)
+	_, rw.err = fmt.Fprintf(rw.w, "%d %s\r\n", status, meta)
+}
+
+func (rw *responseWriter) Write(p []byte) (int, error) {
+	rw.WriteHeader(StatusSuccess, Gemtext)
+	if rw.err != nil {
+		return 0, rw.err
+	}
+	return rw.w.Write(p)
+}
+
+func serveConn(conn net.Conn, h Handler) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(connTimeout))
+
+	rw := &responseWriter{w: conn}
+	// like net/http, a panicking handler only
+	// takes its own connection down with it
+	defer func() {
+		if err := recover(); err != nil {
+			log.Printf("gemini: panic serving %s: %v\n%s", conn.RemoteAddr(), err, debug.Stack())
+			rw.WriteHeader(StatusTemporaryFailure, "internal error")
+		}
+	}()
+	r, status, err := readRequest(conn)
+	if err != nil {
+		rw.WriteHeader(status, err.Error())
+		return
+	}
+	h.ServeGemini(rw, r)
+	if !rw.wroteHeader {
+		rw.WriteHeader(StatusTemporaryFailure, "no response")
+	}
+	if rw.err != nil {
+		log.Printf("gemini: %s\n", rw.err)
+	}
+}
+
+// readRequest reads & checks the request line. if it's no good,
+// the returned status is what the client should be told.
+func readRequest(conn net.Conn) (*Request, int, error) {
+	var cert *x509.Certificate
+	if tc, ok := conn.(*tls.Conn); ok {
+		err := tc.Handshake()
+		if err != nil {
+			return nil, StatusBadRequest, err
+		}
+		if peers := tc.ConnectionState().PeerCertificates; len(peers) > 0 {
+			cert = peers[0]
+		}
+	}
+
+	// +2 for the \r\n
+	line, err := bufio.NewReaderSize(io.LimitReader(conn, maxRequestLength+2), maxRequestLength+2).ReadString('\n')
+	if err != nil {
+		return nil, StatusBadRequest, errors.New("request too long or cut off")
+	}
+	raw, ok := strings.CutSuffix(line, "\r\n")
+	if !ok || raw == "" {
+		return nil, StatusBadRequest, errors.New("request must be a url followed by \\r\\n")
+	}
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() {
+		return nil, StatusBadRequest, errors.New("request must be an absolute url")
+	}
+	if u.Scheme != "gemini" {
+		return nil, StatusProxyRequestRefused, errors.New("only gemini:// urls are served here")
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return &Request{URL: u, Certificate: cert}, 0, nil
+}
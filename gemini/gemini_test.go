@@ -0,0 +1,166 @@
+package gemini
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// serve starts a server for h on a random port
+func serve(t *testing.T, h Handler) string {
+	t.Helper()
+	dir := t.TempDir()
+	cert, err := LoadOrCreateCertificate(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := Listen("127.0.0.1:0", cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go Serve(l, h)
+	return l.Addr().String()
+}
+
+// send writes a raw request line and returns the whole response
+func send(t *testing.T, addr string, request string) (string, string) {
+	t.Helper()
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = io.WriteString(conn, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	header, err := br.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(br)
+	return header, string(body)
+}
+
+func TestServe(t *testing.T) {
+	addr := serve(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		switch r.URL.Path {
+		case "/":
+			io.WriteString(w, "# hello "+r.URL.RawQuery+"\n")
+		case "/quiet":
+		default:
+			w.WriteHeader(StatusNotFound, "nothing at\r\n"+r.URL.Path)
+		}
+	}))
+
+	for _, tc := range []struct {
+		request string
+		header  string
+		body    string
+	}{
+		{"gemini://localhost/?jes\r\n", "20 " + Gemtext + "\r\n", "# hello jes\n"},
+		// no path at all is the root
+		{"gemini://localhost\r\n", "20 " + Gemtext + "\r\n", "# hello \n"},
+		{"gemini://localhost/nope\r\n", "51 nothing at /nope\r\n", ""},
+		{"gemini://localhost/quiet\r\n", "40 no response\r\n", ""},
+		{"https://localhost/\r\n", "53 only gemini:// urls are served here\r\n", ""},
+		{"/relative\r\n", "59 request must be an absolute url\r\n", ""},
+		{"gemini://localhost/\n", "59 request must be a url followed by \\r\\n\r\n", ""},
+		{"gemini://localhost/" + strings.Repeat("a", maxRequestLength) + "\r\n", "59 request too long or cut off\r\n", ""},
+	} {
+		header, body := send(t, addr, tc.request)
+		if header != tc.header || body != tc.body {
+			t.Errorf("%q: got %q %q, want %q %q", tc.request, header, body, tc.header, tc.body)
+		}
+	}
+}
+
+func TestClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	client, err := LoadOrCreateCertificate(filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key"), "jes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprints := make(chan string, 1)
+	addr := serve(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.Certificate == nil {
+			fingerprints <- ""
+		} else {
+			fingerprints <- Fingerprint(r.Certificate)
+		}
+		w.WriteHeader(StatusSuccess, Gemtext)
+	}))
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true, Certificates: []tls.Certificate{client}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(conn, "gemini://localhost/\r\n")
+	io.ReadAll(conn)
+	conn.Close()
+
+	leaf, err := parseLeaf(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := <-fingerprints; got != Fingerprint(leaf) {
+		t.Fatalf("got fingerprint %q, want %q", got, Fingerprint(leaf))
+	}
+
+	send(t, addr, "gemini://localhost/\r\n")
+	if got := <-fingerprints; got != "" {
+		t.Fatalf("no certificate should mean no fingerprint, got %q", got)
+	}
+}
+
+func TestLoadOrCreateCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	first, err := LoadOrCreateCertificate(certFile, keyFile, "vore.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := LoadOrCreateCertificate(certFile, keyFile, "vore.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// clients pin the certificate, it mustn't change between restarts
+	if !bytes.Equal(first.Certificate[0], second.Certificate[0]) {
+		t.Fatal("the saved certificate should be reused")
+	}
+	leaf, err := parseLeaf(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := leaf.VerifyHostname("vore.test"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func parseLeaf(cert tls.Certificate) (*x509.Certificate, error) {
+	return x509.ParseCertificate(cert.Certificate[0])
+}
+
+func TestServePanic(t *testing.T) {
+	addr := serve(t, HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.URL.Path == "/boom" {
+			panic("boom")
+		}
+		io.WriteString(w, "# fine\n")
+	}))
+
+	if header, _ := send(t, addr, "gemini://localhost/boom\r\n"); header != "40 internal error\r\n" {
+		t.Errorf("panicking handler: got %q", header)
+	}
+	// the server is still up
+	if header, body := send(t, addr, "gemini://localhost/\r\n"); header != "20 "+Gemtext+"\r\n" || body != "# fine\n" {
+		t.Errorf("after a panic: got %q %q", header, body)
+	}
+}
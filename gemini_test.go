@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"git.j3s.sh/vore/gemini"
+	"git.j3s.sh/vore/sqlite"
+)
+
+// serveGemini starts the site's gemini server on a random port
+func serveGemini(t *testing.T, s *Site) string {
+	t.Helper()
+	dir := t.TempDir()
+	cert, err := gemini.LoadOrCreateCertificate(filepath.Join(dir, "gemini.crt"), filepath.Join(dir, "gemini.key"), "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := gemini.Listen("127.0.0.1:0", cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go gemini.Serve(l, s.geminiHandler())
+	return l.Addr().String()
+}
+
+// geminiGet is a tiny gemini client. it returns the response
+// header, minus the \r\n, and the body.
+func geminiGet(t *testing.T, addr string, target string, certs ...tls.Certificate) (string, string) {
+	t.Helper()
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true, Certificates: certs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = io.WriteString(conn, "gemini://localhost"+target+"\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	header, err := br.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSuffix(header, "\r\n"), string(body)
+}
+
+func TestGeminiPages(t *testing.T) {
+	s, h := newTestSite(t)
+	feed := newBigFeedServer(t, 3)
+	session := register(t, h, "jes", "correct horse")
+	do(h, "POST", "/settings/submit", url.Values{"submit": {feed.URL}}, session)
+	addr := serveGemini(t, s)
+
+	for _, tc := range []struct {
+		target string
+		want   []string
+	}{
+		{"/", []string{"# vore", "=> /saves"}},
+		{"/jes", []string{"# jes's vore", "=> https://blog.example/0 post 0", "via blog.example"}},
+		{"/feeds/" + url.QueryEscape(feed.URL), []string{"# " + feed.URL, "## big feed", "## 3 items", "=> https://blog.example/2 post 2"}},
+	} {
+		header, body := geminiGet(t, addr, tc.target)
+		if header != "20 "+gemini.Gemtext {
+			t.Errorf("%s: got header %q", tc.target, header)
+			continue
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(body, want) {
+				t.Errorf("%s: missing %q in:\n%s", tc.target, want, body)
+			}
+		}
+	}
+
+	for _, target := range []string{"/nobody", "/feeds/" + url.QueryEscape("https://nowhere.example/feed"), "/jes/nope"} {
+		if header, _ := geminiGet(t, addr, target); !strings.HasPrefix(header, "51 ") {
+			t.Errorf("%s: got header %q, want 51", target, header)
+		}
+	}
+}
+
+func TestGeminiSaves(t *testing.T) {
+	s, h := newTestSite(t)
+	session := register(t, h, "jes", "correct horse")
+	err := s.db.WriteSavedItem("jes", sqlite.SavedItem{
+		ItemURL:    "https://blog.example/0",
+		ItemTitle:  "post 0",
+		ArchiveURL: "https://archive.example/0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// feeds decide what these look like
+	for _, si := range []sqlite.SavedItem{
+		{ItemURL: "https://evil.example/a\n# pwned\n=> https://phish.example", ItemTitle: "evil\n## heading", ArchiveURL: "https://archive.example/a b"},
+		{ItemURL: "https://evil.example/a b", ItemTitle: "spaced", ArchiveURL: "https://archive.example/1"},
+	} {
+		err = s.db.WriteSavedItem("jes", si)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	token := newAPIToken(t, h, session, "read")
+	addr := serveGemini(t, s)
+
+	dir := t.TempDir()
+	cert, err := gemini.LoadOrCreateCertificate(filepath.Join(dir, "me.crt"), filepath.Join(dir, "me.key"), "jes")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if header, _ := geminiGet(t, addr, "/saves"); !strings.HasPrefix(header, "60 ") {
+		t.Fatalf("no certificate: got %q, want 60", header)
+	}
+	if header, _ := geminiGet(t, addr, "/saves", cert); !strings.HasPrefix(header, "11 ") {
+		t.Fatalf("new certificate: got %q, want 11", header)
+	}
+	if header, _ := geminiGet(t, addr, "/saves?vore_nope", cert); !strings.HasPrefix(header, "61 ") {
+		t.Fatalf("bad token: got %q, want 61", header)
+	}
+	if header, _ := geminiGet(t, addr, "/saves?"+url.QueryEscape(token), cert); header != "30 /saves" {
+		t.Fatalf("good token: got %q, want a redirect", header)
+	}
+	header, body := geminiGet(t, addr, "/saves", cert)
+	if header != "20 "+gemini.Gemtext {
+		t.Fatalf("linked certificate: got %q", header)
+	}
+	for _, want := range []string{"# jes's saves", "=> https://blog.example/0 post 0", "=> https://archive.example/0", "* spaced\n", "* evil ## heading\n"} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("missing %q in:\n%s", want, body)
+		}
+	}
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, "# pwned") || strings.HasPrefix(line, "## heading") || strings.Contains(line, "phish.example") || strings.HasPrefix(line, "=> https://evil.example") || strings.HasPrefix(line, "=> https://archive.example/a") {
+			t.Fatalf("a feed's link got to write gemtext: %q in:\n%s", line, body)
+		}
+	}
+
+	// revoking the token unlinks the certificate
+	id := s.db.GetUserAPITokens("jes")[0].ID
+	do(h, "POST", "/settings/tokens/revoke", url.Values{"id": {strconv.Itoa(id)}}, session)
+	if header, _ := geminiGet(t, addr, "/saves", cert); !strings.HasPrefix(header, "11 ") {
+		t.Fatalf("revoked token: got %q, want 11", header)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"io"
+	"net/url"
+	"strings"
+
+	"git.j3s.sh/vore/gopher"
+	"git.j3s.sh/vore/lib"
+)
+
+// gopherHandler serves a directory of users, their homepages and
+// their saves as gopher menus. everything links out to the web.
+func (s *Site) gopherHandler() gopher.Handler {
+	return gopher.HandlerFunc(func(w io.Writer, r *gopher.Request) {
+		// pages are picked like on the web, ?before= or ?after=
+		selector, rawQuery, _ := strings.Cut(strings.TrimPrefix(r.Selector, "/"), "?")
+		q, _ := url.ParseQuery(rawQuery)
+		var items []gopher.Item
+		switch {
+		case selector == "":
+			items = s.gopherDirectory()
+		case selector == "saves":
+			items = s.gopherSaves(r.Search)
+		case !strings.Contains(selector, "/") && s.db.UserExists(selector):
+			items = s.gopherTimeline(selector, q.Get("before"), q.Get("after"))
+		default:
+			items = []gopher.Item{gopher.Error("not found")}
+		}
+		gopher.WriteMenu(w, r, items)
+	})
+}
+
+func (s *Site) gopherDirectory() []gopher.Item {
+	items := []gopher.Item{
+		gopher.Info("vore, a simple feed reader"),
+		gopher.Info(""),
+	}
+	for _, username := range s.db.GetAllUsernames() {
+		items = append(items, gopher.Item{Type: gopher.TypeMenu, Display: username, Selector: "/" + username})
+	}
+	return append(items,
+		gopher.Info(""),
+		gopher.Item{Type: gopher.TypeSearch, Display: "your saves (search with a read-only api token, sent unencrypted)", Selector: "/saves"},
+	)
+}
+
+func (s *Site) gopherTimeline(username string, before string, after string) []gopher.Item {
+	page, err := paginate(s.timeline(username), before, after, timelinePageSize)
+	if err != nil {
+		return []gopher.Item{gopher.Error(err.Error())}
+	}
+	items := []gopher.Item{
+		gopher.Info(username + "'s vore"),
+		gopher.Info(""),
+	}
+	for _, i := range page.Items {
+		items = append(items,
+			gopher.Link(orLink(oneLine(i.Title), i.Link), i.Link),
+			gopher.Info("published "+s.timeSince(i.Date)+" via "+s.printDomain(i.Link)),
+		)
+	}
+	if len(page.Items) == 0 {
+		items = append(items, gopher.Info("nothing here yet"))
+	}
+	if page.Newer != "" || page.Older != "" {
+		items = append(items, gopher.Info(""))
+	}
+	if page.Newer != "" {
+		items = append(items, gopher.Item{Type: gopher.TypeMenu, Display: "newer", Selector: "/" + username + "?after=" + page.Newer})
+	}
+	if page.Older != "" {
+		items = append(items, gopher.Item{Type: gopher.TypeMenu, Display: "older", Selector: "/" + username + "?before=" + page.Older})
+	}
+	return items
+}
+
+// gopherSaves lists the saves of whoever the api token belongs to.
+// gopher has no logins, so the token goes in as a search. searches
+// travel in the clear, so only read tokens are taken.
+func (s *Site) gopherSaves(token string) []gopher.Item {
+	t, ok := s.db.GetAPIToken(lib.HashToken(strings.TrimSpace(token)))
+	if !ok {
+		return []gopher.Item{gopher.Error("that api token didn't work, make one in /settings on the web")}
+	}
+	if t.Scope != scopeRead {
+		return []gopher.Item{
+			gopher.Error("only read-only api tokens work over gopher, it isn't encrypted."),
+			gopher.Error("that token was just sent in the clear, revoke it in /settings on the web"),
+		}
+	}
+	err := s.touchAPIToken(t)
+	if err != nil {
+		return []gopher.Item{gopher.Error(err.Error())}
+	}
+
+	items := []gopher.Item{
+		gopher.Info(t.Username + "'s saves"),
+		gopher.Info(""),
+	}
+	saves := s.db.GetUserSavedItems(t.Username)
+	for _, save := range saves {
+		items = append(items,
+			gopher.Link(orLink(oneLine(save.ItemTitle), save.ItemURL), save.ItemURL),
+			gopher.Link("archived copy, saved "+s.timeSince(save.CreatedAt), save.ArchiveURL),
+		)
+	}
+	if len(saves) == 0 {
+		items = append(items, gopher.Info("nothing saved yet"))
+	}
+	return items
+}
+
+// orLink stands the link in for an item with no title
+func orLink(title string, link string) string {
+	if title == "" {
+		return link
+	}
+	return title
+}
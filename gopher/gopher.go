@@ -0,0 +1,215 @@
+// Package gopher is enough of gopher to serve menus that link
+// out to the web.
+//
+// https://www.rfc-editor.org/rfc/rfc1436
+package gopher
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net"
+	"runtime/debug"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// DefaultPort is where gopher servers listen unless told otherwise.
+const DefaultPort = 70
+
+// item types, the first character of a menu line
+const (
+	TypeText   = '0'
+	TypeMenu   = '1'
+	TypeError  = '3'
+	TypeSearch = '7'
+	TypeHTML   = 'h'
+	TypeInfo   = 'i'
+)
+
+const (
+	// selectors are short, anything longer is a mistake
+	maxRequestLength = 1024
+	// how long a client has to send its request
+	// and read the response
+	connTimeout = 30 * time.Second
+	// selectors for links out of gopherspace start with this,
+	// clients that know type h don't even ask for them
+	urlPrefix = "URL:"
+)
+
+// Request is a gopher request.
+type Request struct {
+	Selector string
+	// Search is what the user typed into a search item
+	Search string
+	// Host & Port are where this server says it is,
+	// for menu items that point back at it
+	Host string
+	Port int
+}
+
+// Handler answers gopher requests.
+type Handler interface {
+	ServeGopher(w io.Writer, r *Request)
+}
+
+// HandlerFunc lets an ordinary function be a Handler.
+type HandlerFunc func(w io.Writer, r *Request)
+
+// ServeGopher calls f(w, r).
+func (f HandlerFunc) ServeGopher(w io.Writer, r *Request) {
+	f(w, r)
+}
+
+// Item is one line of a menu.
+type Item struct {
+	Type     byte
+	Display  string
+	Selector string
+	// Host & Port default to this server's
+	Host string
+	Port int
+}
+
+// Info is a line of text in a menu.
+func Info(text string) Item {
+	return Item{Type: TypeInfo, Display: text}
+}
+
+// Link is a menu line linking to a url out on the web.
+func Link(display string, url string) Item {
+	return Item{Type: TypeHTML, Display: display, Selector: urlPrefix + url}
+}
+
+// Error is a menu line saying what went wrong.
+func Error(text string) Item {
+	return Item{Type: TypeError, Display: text}
+}
+
+// WriteMenu writes a whole menu in answer to r.
+func WriteMenu(w io.Writer, r *Request, items []Item) error {
+	var buf bytes.Buffer
+	for _, i := range items {
+		if i.Host == "" {
+			i.Host, i.Port = r.Host, r.Port
+		}
+		if i.Type == TypeInfo || i.Type == TypeError {
+			// info lines don't go anywhere, but
+			// clients still expect all four fields
+			i.Selector, i.Host, i.Port = "", "error.host", 1
+		}
+		fmt.Fprintf(&buf, "%c%s\t%s\t%s\t%d\r\n", i.Type, field(i.Display), field(i.Selector), field(i.Host), i.Port)
+	}
+	buf.WriteString(".\r\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// field keeps tabs, line breaks & any other control
+// characters out of menu fields
+func field(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t' || r == '\n':
+			return ' '
+		case unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// Serve answers every connection on l with h, until l is closed.
+// host is the name menus give for this server.
+func Serve(l net.Listener, host string, h Handler) error {
+	port := 0
+	if addr, ok := l.Addr().(*net.TCPAddr); ok {
+		port = addr.Port
+	}
+	for {
+		conn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		go serveConn(conn, host, port, h)
+	}
+}
+
+func serveConn(conn net.Conn, host string, port int, h Handler) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(connTimeout))
+
+	// like net/http, a panicking handler only
+	// takes its own connection down with it
+	defer func() {
+		if err := recover(); err != nil {
+			log.Printf("gopher: panic serving %s: %v\n%s", conn.RemoteAddr(), err, debug.Stack())
+			WriteMenu(conn, &Request{Host: host, Port: port}, []Item{Error("something broke, sorry")})
+		}
+	}()
+	r, err := readRequest(conn)
+	if err != nil {
+		WriteMenu(conn, &Request{Host: host, Port: port}, []Item{Error(err.Error())})
+		return
+	}
+	r.Host, r.Port = host, port
+	if url, ok := strings.CutPrefix(r.Selector, urlPrefix); ok {
+		err = writeRedirect(conn, url)
+	} else {
+		// the response goes out in one go once it's ready,
+		// handlers don't have to care about the connection
+		var buf bytes.Buffer
+		h.ServeGopher(&buf, r)
+		_, err = conn.Write(buf.Bytes())
+	}
+	if err != nil {
+		log.Printf("gopher: %s\n", err)
+	}
+}
+
+// writeRedirect is for clients that don't know about type h,
+// and ask us for the link instead: they get a page that sends
+// them on to it
+func writeRedirect(w io.Writer, url string) error {
+	url = html.EscapeString(url)
+	_, err := fmt.Fprintf(w, `<!DOCTYPE html>
+<html>
+<head>
+<meta http-equiv="refresh" content="0; url=%s">
+</head>
+<body>
+<a href="%s">%s</a>
+</body>
+</html>
+`, url, url, url)
+	return err
+}
+
+// readRequest reads the selector line, and the search
+// string after a tab if there is one
+func readRequest(conn net.Conn) (*Request, error) {
+	// +2 for the \r\n
+	line, err := bufio.NewReaderSize(io.LimitReader(conn, maxRequestLength+2), maxRequestLength+2).ReadString('\n')
+	if err != nil {
+		return nil, errors.New("request too long or cut off")
+	}
+	// plenty of clients only send \n
+	line = strings.TrimRight(line, "\r\n")
+
+	// gopher+ clients tack on more fields, they can go
+	fields := strings.Split(line, "\t")
+	r := &Request{Selector: fields[0]}
+	if len(fields) > 1 {
+		r.Search = fields[1]
+	}
+	return r, nil
+}
@@ -0,0 +1,99 @@
+package gopher
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// serve starts a server for h on a random port
+func serve(t *testing.T, h Handler) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go Serve(l, "gopher.example", h)
+	return l.Addr().String()
+}
+
+// send writes a raw request and returns the whole response
+func send(t *testing.T, addr string, request string) string {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = io.WriteString(conn, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(response)
+}
+
+func TestServe(t *testing.T) {
+	addr := serve(t, HandlerFunc(func(w io.Writer, r *Request) {
+		WriteMenu(w, r, []Item{
+			Info("selector " + r.Selector + ", search " + r.Search),
+			{Type: TypeMenu, Display: "a\tmenu", Selector: "/menu"},
+			Link("the\nweb", "https://blog.example/"),
+			Info("no\x1b[2J escapes\r\u009b"),
+		})
+	}))
+	_, port, _ := net.SplitHostPort(addr)
+
+	want := "iselector /jes, search hello there\t\terror.host\t1\r\n" +
+		"1a menu\t/menu\tgopher.example\t" + port + "\r\n" +
+		"hthe web\tURL:https://blog.example/\tgopher.example\t" + port + "\r\n" +
+		"ino[2J escapes\t\terror.host\t1\r\n" +
+		".\r\n"
+	if got := send(t, addr, "/jes\thello there\r\n"); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if got := send(t, addr, "/jes\thello there\t+\n"); got != want {
+		t.Fatalf("gopher+ & bare \\n: got %q, want %q", got, want)
+	}
+
+	got := send(t, addr, "URL:https://blog.example/?a=1&b=2\r\n")
+	if !strings.Contains(got, `url=https://blog.example/?a=1&amp;b=2`) {
+		t.Fatalf("URL: selectors should redirect, got %q", got)
+	}
+
+	got = send(t, addr, strings.Repeat("a", maxRequestLength+2))
+	if want := "3request too long or cut off\t\terror.host\t1\r\n.\r\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestWriteMenuElsewhere(t *testing.T) {
+	var b strings.Builder
+	r := &Request{Host: "here.example", Port: DefaultPort}
+	WriteMenu(&b, r, []Item{{Type: TypeMenu, Display: "there", Selector: "/", Host: "there.example", Port: 7070}})
+	if want := "1there\t/\tthere.example\t7070\r\n.\r\n"; b.String() != want {
+		t.Fatalf("got %q, want %q", b.String(), want)
+	}
+}
+
+func TestServePanic(t *testing.T) {
+	addr := serve(t, HandlerFunc(func(w io.Writer, r *Request) {
+		if r.Selector == "/boom" {
+			panic("boom")
+		}
+		WriteMenu(w, r, []Item{Info("fine")})
+	}))
+
+	if got, want := send(t, addr, "/boom\r\n"), "3something broke, sorry\t\terror.host\t1\r\n.\r\n"; got != want {
+		t.Errorf("panicking handler: got %q, want %q", got, want)
+	}
+	// the server is still up
+	if got, want := send(t, addr, "/\r\n"), "ifine\t\terror.host\t1\r\n.\r\n"; got != want {
+		t.Errorf("after a panic: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+
+	"git.j3s.sh/vore/gopher"
+	"git.j3s.sh/vore/sqlite"
+)
+
+// serveGopher starts the site's gopher server on a random port
+func serveGopher(t *testing.T, s *Site) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go gopher.Serve(l, "vore.test", s.gopherHandler())
+	return l.Addr().String()
+}
+
+// gopherGet sends a request & returns the menu it gets back
+func gopherGet(t *testing.T, addr string, request string) string {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = io.WriteString(conn, request+"\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	menu, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(menu)
+}
+
+func TestGopherMenus(t *testing.T) {
+	s, h := newTestSite(t)
+	feed := newBigFeedServer(t, 3)
+	session := register(t, h, "jes", "correct horse")
+	do(h, "POST", "/settings/submit", url.Values{"submit": {feed.URL}}, session)
+	register(t, h, "bob", "correct horse")
+	err := s.db.WriteSavedItem("jes", sqlite.SavedItem{
+		ItemURL:    "https://blog.example/0",
+		ItemTitle:  "post 0",
+		ArchiveURL: "https://archive.example/0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := newAPIToken(t, h, session, "read")
+	writeToken := newAPIToken(t, h, session, "write")
+	addr := serveGopher(t, s)
+	_, port, _ := net.SplitHostPort(addr)
+
+	for _, tc := range []struct {
+		request string
+		want    []string
+	}{
+		{"", []string{"1bob\t/bob\tvore.test\t" + port + "\r\n", "1jes\t/jes\tvore.test\t" + port + "\r\n", "7your saves (search with a read-only api token, sent unencrypted)"}},
+		{"/", []string{"1jes\t/jes\t"}},
+		{"/jes", []string{"ijes's vore\t", "hpost 0\tURL:https://blog.example/0\t", "hpost 2\tURL:https://blog.example/2\t", "via blog.example"}},
+		{"/bob", []string{"inothing here yet\t"}},
+		{"/saves\t" + token, []string{"ijes's saves\t", "hpost 0\tURL:https://blog.example/0\t", "URL:https://archive.example/0\t"}},
+		{"/saves\t" + writeToken, []string{"3only read-only api tokens work"}},
+		{"/saves\tvore_nope", []string{"3that api token didn't work"}},
+		{"/saves", []string{"3that api token didn't work"}},
+		{"/nobody", []string{"3not found\t"}},
+		{"/jes/nope", []string{"3not found\t"}},
+	} {
+		menu := gopherGet(t, addr, tc.request)
+		if !strings.HasSuffix(menu, "\r\n.\r\n") {
+			t.Errorf("%q: menus end with a dot:\n%s", tc.request, menu)
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(menu, want) {
+				t.Errorf("%q: missing %q in:\n%s", tc.request, want, menu)
+			}
+		}
+	}
+
+	// homepages are the same items the web shows, in the same order
+	menu := gopherGet(t, addr, "/jes")
+	if strings.Index(menu, "post 0") > strings.Index(menu, "post 2") {
+		t.Errorf("timeline should be newest first:\n%s", menu)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import "net/http"
+
+// contentSecurityPolicy only lets pages load vore's own assets, plus
+// the third-party scripts that head.tmpl.html pulls in. inline
+// scripts and styles are not allowed, keep js in /static/vore.js.
+const contentSecurityPolicy = "default-src 'self'; " +
+	"script-src 'self' https://unpkg.com https://stats.vore.website; " +
+	"connect-src 'self' https://stats.vore.website; " +
+	"img-src 'self' data: https://stats.vore.website; " +
+	"style-src 'self'; " +
+	"form-action 'self'; " +
+	"frame-ancestors 'none'; " +
+	"base-uri 'none'"
+
+// securityHeaders sets the headers every response should carry
+func (s *Site) securityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Content-Security-Policy", contentSecurityPolicy)
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("Referrer-Policy", "same-origin")
+		if s.behindTLSProxy {
+			h.Set("Strict-Transport-Security", "max-age=31536000")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// setCookie sets c on w with vore's cookie hardening applied: cookies
+// are never readable from javascript, aren't sent along with
+// cross-site subrequests, and are https-only when vore sits behind
+// a tls-terminating proxy.
+func (s *Site) setCookie(w http.ResponseWriter, c *http.Cookie) {
+	c.Path = "/"
+	c.HttpOnly = true
+	c.SameSite = http.SameSiteLaxMode
+	c.Secure = s.behindTLSProxy
+	http.SetCookie(w, c)
+}
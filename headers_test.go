@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// examplePath turns a mux pattern into a path that matches it
+func examplePath(pattern string) (method string, path string) {
+	method, path, ok := strings.Cut(pattern, " ")
+	if !ok {
+		method, path = "GET", pattern
+	}
+	path = strings.ReplaceAll(path, "{$}", "")
+	for strings.Contains(path, "{") {
+		start := strings.Index(path, "{")
+		end := strings.Index(path, "}")
+		path = path[:start] + "x" + path[end+1:]
+	}
+	return method, path
+}
+
+func TestSecurityHeadersOnEveryRoute(t *testing.T) {
+	s, h := newTestSite(t)
+	session := register(t, h, "jes", "correct horse")
+
+	want := map[string]string{
+		"Content-Security-Policy": contentSecurityPolicy,
+		"X-Frame-Options":         "DENY",
+		"X-Content-Type-Options":  "nosniff",
+		"Referrer-Policy":         "same-origin",
+	}
+	for _, rt := range s.routeTable() {
+		method, path := examplePath(rt.pattern)
+		// logged in & out both, since plenty of routes
+		// bail out early for anonymous users
+		for _, cookies := range [][]*http.Cookie{nil, {session}} {
+			w := doRaw(h, method, path, nil, cookies...)
+			for header, value := range want {
+				if got := w.Header().Get(header); got != value {
+					t.Errorf("%s %s (status %d): got %s %q, want %q", method, path, w.Code, header, got, value)
+				}
+			}
+			if got := w.Header().Get("Strict-Transport-Security"); got != "" {
+				t.Errorf("%s %s: hsts should only be sent behind a tls proxy, got %q", method, path, got)
+			}
+		}
+	}
+}
+
+func TestHSTSBehindTLSProxy(t *testing.T) {
+	s, h := newTestSite(t)
+	s.behindTLSProxy = true
+
+	w := do(h, "GET", "/login", nil)
+	if got := w.Header().Get("Strict-Transport-Security"); got == "" {
+		t.Fatal("expected hsts behind a tls proxy")
+	}
+}
+
+func TestCookiesHardened(t *testing.T) {
+	for _, behindTLSProxy := range []bool{false, true} {
+		s, h := newTestSite(t)
+		s.behindTLSProxy = behindTLSProxy
+
+		// the csrf cookie comes from a plain page view,
+		// the session cookie from logging in
+		cookies := do(h, "GET", "/login", nil).Result().Cookies()
+		w := do(h, "POST", "/register", url.Values{"username": {"jes"}, "password": {"correct horse"}})
+		cookies = append(cookies, w.Result().Cookies()...)
+
+		names := make(map[string]bool)
+		for _, c := range cookies {
+			names[c.Name] = true
+			if !c.HttpOnly {
+				t.Errorf("%s: should be HttpOnly", c.Name)
+			}
+			if c.SameSite != http.SameSiteLaxMode {
+				t.Errorf("%s: got SameSite %v, want Lax", c.Name, c.SameSite)
+			}
+			if c.Secure != behindTLSProxy {
+				t.Errorf("%s: got Secure %t, want %t", c.Name, c.Secure, behindTLSProxy)
+			}
+			if c.Path != "/" {
+				t.Errorf("%s: got Path %q, want /", c.Name, c.Path)
+			}
+		}
+		if !names["session_token"] || !names[csrfCookie] {
+			t.Fatalf("expected both session and csrf cookies, got %v", names)
+		}
+	}
+}
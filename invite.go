@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"git.j3s.sh/vore/lib"
+	"git.j3s.sh/vore/sqlite"
+)
+
+const (
+	// how long an invite lasts unless the admin says otherwise
+	defaultInviteDays = 7
+	maxInviteDays     = 365
+	maxInviteUses     = 100
+)
+
+// adminInvitesHandler lists every invite code and who redeemed it
+func (s *Site) adminInvitesHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	data := struct {
+		Invites      []sqlite.Invite
+		Now          time.Time
+		Registration registrationMode
+		DefaultDays  int
+	}{
+		Invites:      s.db.GetInvites(),
+		Now:          time.Now(),
+		Registration: s.registration,
+		DefaultDays:  defaultInviteDays,
+	}
+	s.renderPage(w, r, "adminInvites", data)
+}
+
+// inviteCreateHandler makes a new invite code
+func (s *Site) inviteCreateHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	uses, err := formInt(r, "uses", 1, 1, maxInviteUses)
+	if err != nil {
+		s.renderErr(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	days, err := formInt(r, "days", defaultInviteDays, 1, maxInviteDays)
+	if err != nil {
+		s.renderErr(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	code := lib.GenerateSecureToken(12)
+	if code == "" {
+		s.renderErr(w, "could not generate an invite code", http.StatusInternalServerError)
+		return
+	}
+	expires := time.Now().Add(time.Duration(days) * 24 * time.Hour)
+	err = s.db.CreateInvite(s.username(r), code, uses, expires)
+	if err != nil {
+		s.renderErr(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/admin/invites", http.StatusSeeOther)
+}
+
+// inviteExpireHandler stops an invite code from being used again
+func (s *Site) inviteExpireHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		e := fmt.Sprintf("invalid invite id '%s'", r.FormValue("id"))
+		s.renderErr(w, e, http.StatusBadRequest)
+		return
+	}
+	err = s.db.ExpireInvite(id)
+	if err != nil {
+		s.renderErr(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/admin/invites", http.StatusSeeOther)
+}
+
+// formInt parses an optional integer form field,
+// which must be between min and max inclusive
+func formInt(r *http.Request, field string, def int, min int, max int) (int, error) {
+	raw := r.FormValue(field)
+	if raw == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < min || n > max {
+		return 0, fmt.Errorf("%s must be a number from %d to %d", field, min, max)
+	}
+	return n, nil
+}
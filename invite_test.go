@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestAdminInvitesRequireAdmin(t *testing.T) {
+	_, h := newTestSite(t)
+	session := register(t, h, "jes", "correct horse")
+
+	w := do(h, "GET", "/admin/invites", nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("logged out: got status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	w = do(h, "GET", "/admin/invites", nil, session)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("not an admin: got status %d, want %d", w.Code, http.StatusForbidden)
+	}
+	w = do(h, "POST", "/admin/invites/create", url.Values{"uses": {"1"}}, session)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("not an admin: got status %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestInviteOnlyRegistration(t *testing.T) {
+	s, h := newTestSite(t)
+	admin := register(t, h, "jes", "correct horse")
+	if err := s.db.SetAdmin("jes", true); err != nil {
+		t.Fatal(err)
+	}
+	s.registration = registrationInvite
+
+	wesley := func(code string) url.Values {
+		return url.Values{"username": {"wesley"}, "password": {"battery staple"}, "invite": {code}}
+	}
+	w := do(h, "POST", "/register", wesley(""))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("no code: got status %d, want %d", w.Code, http.StatusForbidden)
+	}
+	w = do(h, "POST", "/register", wesley("made-up"))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("bad code: got status %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	w = do(h, "POST", "/admin/invites/create", url.Values{"uses": {"1"}, "days": {"1"}}, admin)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("create invite: got status %d: %s", w.Code, w.Body)
+	}
+	invites := s.db.GetInvites()
+	if len(invites) != 1 {
+		t.Fatalf("got %d invites, want 1", len(invites))
+	}
+	code := invites[0].Code
+
+	// the invite link fills in the code
+	w = do(h, "GET", "/login?invite="+code, nil)
+	if !strings.Contains(w.Body.String(), code) {
+		t.Fatal("login page should be prefilled with the invite code")
+	}
+
+	w = do(h, "POST", "/register", wesley(code))
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("good code: got status %d: %s", w.Code, w.Body)
+	}
+
+	// single use
+	form := url.Values{"username": {"forest"}, "password": {"battery staple"}, "invite": {code}}
+	w = do(h, "POST", "/register", form)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("used code: got status %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	w = do(h, "GET", "/admin/invites", nil, admin)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `href="/wesley"`) {
+		t.Fatalf("admin page should list who redeemed the code, got status %d", w.Code)
+	}
+}
+
+func TestInviteIgnoredWhenClosed(t *testing.T) {
+	s, h := newTestSite(t)
+	s.registration = registrationClosed
+	form := url.Values{"username": {"wesley"}, "password": {"battery staple"}, "invite": {"anything"}}
+	w := do(h, "POST", "/register", form)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
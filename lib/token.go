@@ -2,6 +2,7 @@ package lib
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 )
 
@@ -12,3 +13,11 @@ func GenerateSecureToken(length int) string {
 	}
 	return hex.EncodeToString(b)
 }
+
+// HashToken returns the hex sha256 of a token. tokens are only
+// ever stored hashed, so a leaked database can't be used to
+// impersonate anybody.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,33 +1,232 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"strings"
+	"time"
+
+	"git.j3s.sh/vore/finger"
+	"git.j3s.sh/vore/gemini"
+	"git.j3s.sh/vore/gopher"
+	"git.j3s.sh/vore/sqlite"
 )
 
 func main() {
-	s := New()
-
-	http.HandleFunc("GET /{$}", s.indexHandler)
-	http.HandleFunc("GET /{username}", s.userHandler)
-	http.HandleFunc("GET /saves", s.userSavesHandler)
-	http.HandleFunc("GET /static/{file}", s.staticHandler)
-	http.HandleFunc("GET /finger", s.fingerHandler)
-	http.HandleFunc("POST /finger", s.fingerHandler)
-	http.HandleFunc("GET /settings", s.settingsHandler)
-	http.HandleFunc("POST /settings/submit", s.settingsSubmitHandler)
-	http.HandleFunc("GET /login", s.loginHandler)
-	http.HandleFunc("POST /login", s.loginHandler)
-	http.HandleFunc("GET /logout", s.logoutHandler)
-	http.HandleFunc("POST /logout", s.logoutHandler)
-	http.HandleFunc("POST /register", s.registerHandler)
-	http.HandleFunc("GET /save/{url}", s.saveHandler)
-	http.HandleFunc("GET /feeds/{url}", s.feedDetailsHandler)
-
-	// left in-place for backwards compat
-	http.HandleFunc("GET /feeds", s.settingsHandler)
-	http.HandleFunc("POST /feeds/submit", s.settingsSubmitHandler)
+	dsn := flag.String("db", dbPath, "database to use: a sqlite path, or a postgres:// url")
+	behindTLSProxy := flag.Bool("behind-tls-proxy", false, "vore is served over https by a reverse proxy: mark cookies secure and send hsts")
+	registration := flag.String("registration", "open", "who may register: open, invite or closed")
+	dryRun := flag.Bool("dry-run", false, "list pending database migrations and exit")
+	backupNow := flag.Bool("backup", false, "back up the database into -backup-dir and exit")
+	restore := flag.String("restore", "", "replace the database with the given backup and exit (stop vore first!)")
+	backupDir := flag.String("backup-dir", "backups", "directory for database backups")
+	backupKeep := flag.Int("backup-keep", 7, "number of backups to keep, 0 keeps all of them")
+	backupInterval := flag.Duration("backup-interval", 0, "back up the database this often while serving, 0 disables")
+	makeAdmin := flag.String("make-admin", "", "make the given user an admin and exit")
+	geminiAddr := flag.String("gemini", "", fmt.Sprintf("also serve gemini on this address, e.g. :%d", gemini.DefaultPort))
+	geminiCert := flag.String("gemini-cert", "gemini.crt", "gemini tls certificate, made if it and -gemini-key don't exist")
+	geminiKey := flag.String("gemini-key", "gemini.key", "gemini tls key")
+	geminiHost := flag.String("gemini-host", "localhost", "hostname to put in a newly made gemini certificate")
+	fingerAddr := flag.String("finger", "", fmt.Sprintf("also serve finger on this address, e.g. :%d", finger.DefaultPort))
+	fingerItems := flag.Int("finger-items", 10, "how many timeline items a finger shows")
+	gopherAddr := flag.String("gopher", "", fmt.Sprintf("also serve gopher on this address, e.g. :%d", gopher.DefaultPort))
+	gopherHost := flag.String("gopher-host", "localhost", "hostname gopher menus link back to")
+	flag.Parse()
+
+	mode, err := parseRegistrationMode(*registration)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch {
+	case *dryRun:
+		listPendingMigrations(*dsn)
+		return
+	case *restore != "":
+		if strings.HasPrefix(*dsn, "postgres") {
+			log.Fatal("main: -restore only works on sqlite databases, use pg_restore for postgres")
+		}
+		// the sqlite driver takes options after a ?, the file is before it
+		file, _, _ := strings.Cut(*dsn, "?")
+		err = sqlite.Restore(*restore, file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("main: restored %s from %s\n", file, *restore)
+		return
+	}
+
+	db := sqlite.New(*dsn)
+
+	if *backupNow {
+		path, err := db.Backup(*backupDir, *backupKeep)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("main: backed up to %s\n", path)
+		return
+	}
+	if *makeAdmin != "" {
+		err = db.SetAdmin(*makeAdmin, true)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("main: %s is now an admin\n", *makeAdmin)
+		return
+	}
+	if *backupInterval > 0 {
+		go backupLoop(db, *backupDir, *backupKeep, *backupInterval)
+	}
+
+	s := New(db)
+	s.behindTLSProxy = *behindTLSProxy
+	s.registration = mode
+
+	// usernames that predate validation are still served, but
+	// the operator should know about them
+	for _, conflict := range s.usernameConflicts(db.GetAllUsernames()) {
+		log.Printf("main: username conflict: %s\n", conflict)
+	}
+
+	if *geminiAddr != "" {
+		cert, err := gemini.LoadOrCreateCertificate(*geminiCert, *geminiKey, *geminiHost)
+		if err != nil {
+			log.Fatal(err)
+		}
+		l, err := gemini.Listen(*geminiAddr, cert)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("main: listening on gemini://%s\n", l.Addr())
+		go func() { log.Fatal(gemini.Serve(l, s.geminiHandler())) }()
+	}
+
+	if *fingerAddr != "" {
+		l, err := net.Listen("tcp", *fingerAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("main: listening on finger %s\n", l.Addr())
+		go func() { log.Fatal(finger.Serve(l, s.fingerd(*fingerItems))) }()
+	}
+
+	if *gopherAddr != "" {
+		l, err := net.Listen("tcp", *gopherAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("main: listening on gopher://%s\n", l.Addr())
+		go func() { log.Fatal(gopher.Serve(l, *gopherHost, s.gopherHandler())) }()
+	}
 
 	log.Println("main: listening on http://localhost:5544")
-	log.Fatal(http.ListenAndServe(":5544", nil))
+	log.Fatal(http.ListenAndServe(":5544", s.handler()))
+}
+
+// handler wraps the site's routes in middleware
+// that applies to every request
+func (s *Site) handler() http.Handler {
+	return s.securityHeaders(s.csrf(s.routes()))
+}
+
+// route is a single pattern on the site's mux
+type route struct {
+	pattern string
+	handler http.HandlerFunc
+}
+
+// routeTable lists every route the site serves
+func (s *Site) routeTable() []route {
+	routes := []route{
+		{"GET /{$}", s.indexHandler},
+		{"GET /{username}", s.userHandler},
+		{"GET /{username}/{file}", s.userFeedHandler},
+		{"GET /saves", s.userSavesHandler},
+		{"GET /saves" + textSuffix, s.userSavesHandler},
+		{"GET /static/{file}", s.staticHandler},
+		{"GET /finger", s.fingerHandler},
+		{"POST /finger", s.fingerHandler},
+		{"GET /settings", s.settingsHandler},
+		{"POST /settings/submit", s.settingsSubmitHandler},
+		{"POST /settings/sessions/revoke", s.sessionRevokeHandler},
+		{"POST /settings/password", s.passwordChangeHandler},
+		{"POST /settings/delete", s.accountDeleteHandler},
+		{"POST /settings/tokens/create", s.tokenCreateHandler},
+		{"POST /settings/tokens/revoke", s.tokenRevokeHandler},
+		{"GET /settings/2fa", s.twoFactorSetupHandler},
+		{"POST /settings/2fa/enable", s.twoFactorEnableHandler},
+		{"POST /settings/2fa/disable", s.twoFactorDisableHandler},
+		{"GET /login", s.loginHandler},
+		{"POST /login", s.loginHandler},
+		{"GET /login/2fa", s.twoFactorHandler},
+		{"POST /login/2fa", s.twoFactorHandler},
+		{"POST /logout", s.logoutHandler},
+		{"POST /register", s.registerHandler},
+		{"POST /save/{url}", s.saveHandler},
+		{"GET /feeds/{url}", s.feedDetailsHandler},
+		{"GET /api/v1/openapi.json", s.openAPIHandler},
+		{"/api/v1/{path...}", s.apiNotFoundHandler},
+		{"POST " + feverPath + "{$}", s.feverHandler},
+		{"GET /admin", s.adminHandler},
+		{"POST /admin/users/disable", s.adminUserDisableHandler},
+		{"POST /admin/feeds/delete", s.adminFeedDeleteHandler},
+		{"POST /admin/feeds/refresh", s.adminFeedRefreshHandler},
+		{"GET /admin/invites", s.adminInvitesHandler},
+		{"POST /admin/invites/create", s.inviteCreateHandler},
+		{"POST /admin/invites/expire", s.inviteExpireHandler},
+
+		// left in-place for backwards compat
+		{"GET /feeds", s.settingsHandler},
+		{"POST /feeds/submit", s.settingsSubmitHandler},
+	}
+	for _, rt := range s.apiRoutes() {
+		routes = append(routes, route{rt.method + " " + rt.path, rt.handler})
+	}
+	return routes
+}
+
+// routes wires every handler on the site into a fresh mux
+func (s *Site) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	for _, rt := range s.routeTable() {
+		mux.HandleFunc(rt.pattern, rt.handler)
+	}
+	return mux
+}
+
+// listPendingMigrations prints every migration that would be
+// applied on the next startup, without applying any of them.
+func listPendingMigrations(dsn string) {
+	db, err := sqlite.Open(dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pending, err := db.PendingMigrations()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(pending) == 0 {
+		fmt.Println("no pending migrations")
+		return
+	}
+	for _, m := range pending {
+		fmt.Printf("pending: %s (sha256 %s)\n", m.Name, m.Checksum)
+	}
+}
+
+// backupLoop backs up the database every interval, forever
+func backupLoop(db *sqlite.DB, dir string, keep int, interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		start := time.Now()
+		path, err := db.Backup(dir, keep)
+		if err != nil {
+			log.Printf("main: backup failed: %s\n", err)
+			continue
+		}
+		log.Printf("main: backed up to %s in %s\n", path, time.Since(start))
+	}
 }
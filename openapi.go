@@ -0,0 +1,170 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// openAPIHandler describes the api as an openapi 3 document,
+// built from apiRoutes on every request
+func (s *Site) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, s.openAPI(r), http.StatusOK)
+}
+
+// openAPI builds the document. it's plain maps rather than a typed
+// model, the document is only ever written out
+func (s *Site) openAPI(r *http.Request) map[string]any {
+	errorResponse := func(description string) map[string]any {
+		return map[string]any{
+			"description": description,
+			"content": map[string]any{
+				"application/json": map[string]any{
+					"schema": map[string]any{"$ref": "#/components/schemas/error"},
+				},
+			},
+		}
+	}
+
+	paths := map[string]map[string]any{}
+	for _, rt := range s.apiRoutes() {
+		op := map[string]any{
+			"summary":     rt.summary,
+			"operationId": operationID(rt),
+		}
+
+		var params []map[string]any
+		for _, p := range rt.params {
+			params = append(params, map[string]any{
+				"name":        p.name,
+				"in":          p.in,
+				"description": p.description,
+				"required":    p.in == "path",
+				"schema":      map[string]any{"type": "string"},
+			})
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+
+		if rt.request != nil {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": jsonSchema(reflect.TypeOf(rt.request))},
+				},
+			}
+		}
+
+		success := map[string]any{"description": http.StatusText(rt.status)}
+		if rt.response != nil {
+			success["content"] = map[string]any{
+				"application/json": map[string]any{"schema": jsonSchema(reflect.TypeOf(rt.response))},
+			}
+		}
+		responses := map[string]any{
+			strconv.Itoa(rt.status): success,
+			"400":                   errorResponse("the request was invalid"),
+			"404":                   errorResponse("whatever the request refers to doesn't exist"),
+		}
+		if rt.scope == "" {
+			op["security"] = []any{}
+		} else {
+			responses["401"] = errorResponse("no valid session or api token")
+			if rt.scope == scopeWrite {
+				responses["403"] = errorResponse("the api token is read-only")
+			}
+		}
+		op["responses"] = responses
+
+		if paths[rt.path] == nil {
+			paths[rt.path] = map[string]any{}
+		}
+		paths[rt.path][strings.ToLower(rt.method)] = op
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   s.title + " api",
+			"version": "1",
+		},
+		"servers": []any{map[string]any{"url": s.baseURL(r)}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": map[string]any{
+				"error": jsonSchema(reflect.TypeOf(apiError{})),
+			},
+			"securitySchemes": map[string]any{
+				"token": map[string]any{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "an api token from /settings",
+				},
+			},
+		},
+		"security": []any{map[string]any{"token": []any{}}},
+	}
+}
+
+// operationID names an operation after its handler's
+// place in the api, e.g. delete_subscriptions_url
+func operationID(rt apiRoute) string {
+	path := strings.TrimPrefix(rt.path, "/api/v1/")
+	path = strings.NewReplacer("/", "_", "{", "", "}", "").Replace(path)
+	return strings.ToLower(rt.method) + "_" + path
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// jsonSchema describes how encoding/json writes values of type t
+func jsonSchema(t reflect.Type) map[string]any {
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return jsonSchema(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": jsonSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": jsonSchema(t.Elem())}
+	case reflect.Struct:
+		props := map[string]any{}
+		var required []string
+		for i := range t.NumField() {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			props[name] = jsonSchema(f.Type)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		schema := map[string]any{"type": "object", "properties": props}
+		if required != nil {
+			schema["required"] = required
+		}
+		return schema
+	}
+	return map[string]any{}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"time"
+
+	"git.j3s.sh/vore/reaper"
+	"git.j3s.sh/vore/rss"
+)
+
+// publishedItems caps how many items a published feed carries,
+// readers only care about what's new anyway. older pages are
+// linked, for the ones that do want more.
+const publishedItems = 50
+
+// timeline is every item the user's homepage shows, newest
+// first, narrowed down by any filters
+func (s *Site) timeline(username string, filters ...reaper.ItemFilter) []*rss.Item {
+	return s.reaper.TrimFuturePosts(s.reaper.FilterItems(s.reaper.UserTimeline(username), filters...))
+}
+
+// baseURL is where the client reached vore, for
+// building the absolute urls feeds need
+func (s *Site) baseURL(r *http.Request) string {
+	scheme := "http"
+	if s.behindTLSProxy || r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// itemID gives an item an id that's unique across every feed a
+// user follows. guids are only unique within their own feed, so
+// they're only used when they're full uris.
+func itemID(i *rss.Item) string {
+	if u, err := url.Parse(i.ID); err == nil && u.IsAbs() {
+		return i.ID
+	}
+	if i.Link != "" {
+		return i.Link
+	}
+	sum := sha256.Sum256([]byte(i.ID + "\x00" + i.Title))
+	return "urn:sha256:" + hex.EncodeToString(sum[:])
+}
+
+// userFeedHandler publishes a user's homepage as a feed, in
+// whichever format the file name asks for
+func (s *Site) userFeedHandler(w http.ResponseWriter, r *http.Request) {
+	username := r.PathValue("username")
+	var write func(http.ResponseWriter, *http.Request, string, timelinePage) error
+	switch r.PathValue("file") {
+	case "feed.atom":
+		write = s.writeAtom
+	case "feed.rss":
+		write = s.writeRSS
+	case "feed.json":
+		write = s.writeJSONFeed
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if !s.db.UserExists(username) {
+		http.NotFound(w, r)
+		return
+	}
+
+	page, err := s.requestedPage(r, username, publishedItems)
+	if err != nil {
+		s.renderErr(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = write(w, r, username, page)
+	if err != nil {
+		s.renderErr(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// updated is when the feed last changed: when its newest item was published
+func updated(items []*rss.Item) time.Time {
+	if len(items) == 0 || items[0].Date.IsZero() {
+		return time.Now().UTC()
+	}
+	return items[0].Date.UTC()
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	Title     string    `xml:"title"`
+	Link      atomLink  `xml:"link"`
+	ID        string    `xml:"id"`
+	Updated   string    `xml:"updated"`
+	Published string    `xml:"published"`
+	Summary   *atomText `xml:"summary,omitempty"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  string      `xml:"author>name"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+func (s *Site) writeAtom(w http.ResponseWriter, r *http.Request, username string, page timelinePage) error {
+	items := page.Items
+	home := s.baseURL(r) + "/" + username
+	feed := atomFeed{
+		Title:   username + "'s vore",
+		ID:      home,
+		Updated: updated(items).Format(time.RFC3339),
+		Author:  username,
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: home + "/feed.atom"},
+			{Rel: "alternate", Type: "text/html", Href: home},
+		},
+	}
+	// rfc 5005 paging, for readers that want the back catalogue
+	if page.Older != "" {
+		feed.Links = append(feed.Links, atomLink{Rel: "next", Type: "application/atom+xml", Href: s.baseURL(r) + pageLink(r, "before", page.Older)})
+	}
+	if page.Newer != "" {
+		feed.Links = append(feed.Links, atomLink{Rel: "previous", Type: "application/atom+xml", Href: s.baseURL(r) + pageLink(r, "after", page.Newer)})
+	}
+	for _, i := range items {
+		date := i.Date.UTC().Format(time.RFC3339)
+		entry := atomEntry{
+			Title:     i.Title,
+			Link:      atomLink{Href: i.Link},
+			ID:        itemID(i),
+			Updated:   date,
+			Published: date,
+		}
+		if i.Summary != "" {
+			entry.Summary = &atomText{Type: "html", Body: i.Summary}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	return writeXML(w, feed)
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	ID          string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link,omitempty"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Description string  `xml:"description,omitempty"`
+}
+
+type rssFeed struct {
+	XMLName     xml.Name  `xml:"rss"`
+	Version     string    `xml:"version,attr"`
+	Title       string    `xml:"channel>title"`
+	Link        string    `xml:"channel>link"`
+	Description string    `xml:"channel>description"`
+	PubDate     string    `xml:"channel>pubDate"`
+	Items       []rssItem `xml:"channel>item"`
+}
+
+func (s *Site) writeRSS(w http.ResponseWriter, r *http.Request, username string, page timelinePage) error {
+	items := page.Items
+	home := s.baseURL(r) + "/" + username
+	feed := rssFeed{
+		Version:     "2.0",
+		Title:       username + "'s vore",
+		Link:        home,
+		Description: "everything " + username + " reads on vore",
+		PubDate:     updated(items).Format(time.RFC1123Z),
+	}
+	for _, i := range items {
+		id := itemID(i)
+		feed.Items = append(feed.Items, rssItem{
+			Title:       i.Title,
+			Link:        i.Link,
+			GUID:        rssGUID{IsPermaLink: id == i.Link, ID: id},
+			PubDate:     i.Date.UTC().Format(time.RFC1123Z),
+			Description: i.Summary,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	return writeXML(w, feed)
+}
+
+func writeXML(w http.ResponseWriter, v any) error {
+	_, err := w.Write([]byte(xml.Header))
+	if err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	return enc.Encode(v)
+}
+
+// https://www.jsonfeed.org/version/1.1/
+type jsonFeedItem struct {
+	ID            string `json:"id"`
+	URL           string `json:"url,omitempty"`
+	Title         string `json:"title,omitempty"`
+	ContentHTML   string `json:"content_html"`
+	DatePublished string `json:"date_published"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+type jsonFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url"`
+	FeedURL     string           `json:"feed_url"`
+	NextURL     string           `json:"next_url,omitempty"`
+	Authors     []jsonFeedAuthor `json:"authors"`
+	Items       []jsonFeedItem   `json:"items"`
+}
+
+func (s *Site) writeJSONFeed(w http.ResponseWriter, r *http.Request, username string, page timelinePage) error {
+	items := page.Items
+	home := s.baseURL(r) + "/" + username
+	feed := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       username + "'s vore",
+		HomePageURL: home,
+		FeedURL:     home + "/feed.json",
+		Authors:     []jsonFeedAuthor{{Name: username, URL: home}},
+		Items:       []jsonFeedItem{},
+	}
+	if page.Older != "" {
+		feed.NextURL = s.baseURL(r) + pageLink(r, "before", page.Older)
+	}
+	for _, i := range items {
+		feed.Items = append(feed.Items, jsonFeedItem{
+			ID:            itemID(i),
+			URL:           i.Link,
+			Title:         i.Title,
+			ContentHTML:   i.Summary,
+			DatePublished: i.Date.UTC().Format(time.RFC3339),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/feed+json; charset=utf-8")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(feed)
+}
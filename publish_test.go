@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"git.j3s.sh/vore/rss"
+)
+
+func TestUserFeeds(t *testing.T) {
+	_, h := newTestSite(t)
+	feed := newFeedServer(t)
+	session := register(t, h, "jes", "correct horse")
+	do(h, "POST", "/settings/submit", url.Values{"submit": {feed.URL}}, session)
+
+	wantDate := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	for _, file := range []string{"feed.atom", "feed.rss"} {
+		w := do(h, "GET", "/jes/"+file, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: got status %d", file, w.Code)
+		}
+		// vore should be able to read its own feeds
+		parsed, err := rss.Parse(w.Body.Bytes())
+		if err != nil {
+			t.Fatalf("%s: %s\n%s", file, err, w.Body)
+		}
+		if len(parsed.Items) != 1 {
+			t.Fatalf("%s: got %d items, want 1", file, len(parsed.Items))
+		}
+		item := parsed.Items[0]
+		if item.Title != "hello from the test feed" || item.Link != "https://blog.example/hello" {
+			t.Errorf("%s: got item %+v", file, item)
+		}
+		if item.ID != "https://blog.example/hello" {
+			t.Errorf("%s: got id %q", file, item.ID)
+		}
+		if !item.Date.Equal(wantDate) {
+			t.Errorf("%s: got date %s, want %s", file, item.Date, wantDate)
+		}
+	}
+
+	w := do(h, "GET", "/jes/feed.json", nil)
+	if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "application/feed+json") {
+		t.Fatalf("got content type %q", got)
+	}
+	var jf jsonFeed
+	if err := json.Unmarshal(w.Body.Bytes(), &jf); err != nil {
+		t.Fatal(err)
+	}
+	if jf.Version != "https://jsonfeed.org/version/1.1" || len(jf.Items) != 1 {
+		t.Fatalf("got json feed %+v", jf)
+	}
+	if jf.Items[0].DatePublished != "2006-01-02T15:04:05Z" || jf.Items[0].ID != "https://blog.example/hello" {
+		t.Fatalf("got item %+v", jf.Items[0])
+	}
+
+	// homepages advertise their feeds
+	if !strings.Contains(do(h, "GET", "/jes", nil).Body.String(), `href="/jes/feed.atom"`) {
+		t.Fatal("homepage should link to its atom feed")
+	}
+}
+
+func TestUserFeedPages(t *testing.T) {
+	_, h := newTestSite(t)
+	feed := newBigFeedServer(t, publishedItems+3)
+	session := register(t, h, "jes", "correct horse")
+	do(h, "POST", "/settings/submit", url.Values{"submit": {feed.URL}}, session)
+
+	w := do(h, "GET", "/jes/feed.json", nil)
+	var jf jsonFeed
+	if err := json.Unmarshal(w.Body.Bytes(), &jf); err != nil {
+		t.Fatal(err)
+	}
+	if len(jf.Items) != publishedItems || jf.NextURL == "" {
+		t.Fatalf("got %d items & next_url %q", len(jf.Items), jf.NextURL)
+	}
+	next, err := url.Parse(jf.NextURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = do(h, "GET", next.RequestURI(), nil)
+	jf = jsonFeed{}
+	if err := json.Unmarshal(w.Body.Bytes(), &jf); err != nil {
+		t.Fatal(err)
+	}
+	if len(jf.Items) != 3 || jf.NextURL != "" {
+		t.Fatalf("last page: got %d items & next_url %q", len(jf.Items), jf.NextURL)
+	}
+
+	// the same cursor pages the atom feed
+	w = do(h, "GET", "/jes/feed.atom?"+next.RawQuery, nil)
+	body := w.Body.String()
+	if strings.Count(body, "<entry>") != 3 || !strings.Contains(body, `rel="previous"`) || strings.Contains(body, `rel="next"`) {
+		t.Fatalf("got atom page:\n%s", body)
+	}
+	if !strings.Contains(do(h, "GET", "/jes/feed.atom", nil).Body.String(), `rel="next"`) {
+		t.Fatal("the first atom page should link the next")
+	}
+}
+
+func TestUserFeedsNotFound(t *testing.T) {
+	_, h := newTestSite(t)
+	register(t, h, "jes", "correct horse")
+	for _, path := range []string{"/nobody/feed.atom", "/jes/feed.xml"} {
+		if w := do(h, "GET", path, nil); w.Code != http.StatusNotFound {
+			t.Errorf("%s: got status %d, want %d", path, w.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestItemID(t *testing.T) {
+	tests := []struct {
+		item rss.Item
+		want string
+	}{
+		{rss.Item{ID: "urn:uuid:1234", Link: "https://a.example/1"}, "urn:uuid:1234"},
+		{rss.Item{ID: "1234", Link: "https://a.example/1"}, "https://a.example/1"},
+	}
+	for _, tt := range tests {
+		if got := itemID(&tt.item); got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+	}
+	a := itemID(&rss.Item{ID: "1", Title: "a"})
+	b := itemID(&rss.Item{ID: "1", Title: "b"})
+	if !strings.HasPrefix(a, "urn:sha256:") || a == b {
+		t.Errorf("items without links should get distinct hashed ids, got %q and %q", a, b)
+	}
+}
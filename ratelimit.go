@@ -0,0 +1,91 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// limiter counts failures per key (an ip, an account, ...) and locks
+// the key out once it fails max times within window. the counts
+// live in memory, so they reset when vore restarts.
+type limiter struct {
+	max     int
+	window  time.Duration
+	lockout time.Duration
+
+	// now is swapped out in tests
+	now func() time.Time
+
+	mu       sync.Mutex
+	failures map[string]*failures
+}
+
+type failures struct {
+	count       int
+	since       time.Time
+	lockedUntil time.Time
+}
+
+func newLimiter(max int, window time.Duration, lockout time.Duration) *limiter {
+	return &limiter{
+		max:      max,
+		window:   window,
+		lockout:  lockout,
+		now:      time.Now,
+		failures: make(map[string]*failures),
+	}
+}
+
+// locked reports whether key is locked out,
+// and if so, for how much longer
+func (l *limiter) locked(key string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, ok := l.failures[key]
+	if !ok {
+		return 0, false
+	}
+	wait := f.lockedUntil.Sub(l.now())
+	return wait, wait > 0
+}
+
+// fail records a failure against key, locking
+// it out if that's one failure too many
+func (l *limiter) fail(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	f, ok := l.failures[key]
+	if !ok || now.Sub(f.since) > l.window {
+		f = &failures{since: now}
+		l.failures[key] = f
+	}
+	f.count++
+	if f.count >= l.max {
+		f.lockedUntil = now.Add(l.lockout)
+	}
+
+	// don't let abandoned keys pile up forever
+	if len(l.failures) > 10000 {
+		l.sweep(now)
+	}
+}
+
+// reset forgets every failure recorded against key
+func (l *limiter) reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.failures, key)
+}
+
+// sweep drops keys whose window and lockout have both passed.
+// callers must hold l.mu.
+func (l *limiter) sweep(now time.Time) {
+	for key, f := range l.failures {
+		if now.Sub(f.since) > l.window && now.After(f.lockedUntil) {
+			delete(l.failures, key)
+		}
+	}
+}
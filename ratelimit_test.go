@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock that only moves when told to
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time      { return c.t }
+func (c *fakeClock) add(d time.Duration) { c.t = c.t.Add(d) }
+func newFakeClock() *fakeClock           { return &fakeClock{t: time.Date(2024, 4, 20, 0, 0, 0, 0, time.UTC)} }
+
+func TestLimiterLocksOut(t *testing.T) {
+	clock := newFakeClock()
+	l := newLimiter(3, time.Minute, 10*time.Minute)
+	l.now = clock.now
+
+	for i := 0; i < 2; i++ {
+		l.fail("jes")
+		if _, locked := l.locked("jes"); locked {
+			t.Fatalf("locked after %d failures, want 3", i+1)
+		}
+	}
+	l.fail("jes")
+	wait, locked := l.locked("jes")
+	if !locked || wait != 10*time.Minute {
+		t.Fatalf("got locked=%t wait=%s, want locked for 10m", locked, wait)
+	}
+	if _, locked := l.locked("wesley"); locked {
+		t.Fatal("other keys should not be locked")
+	}
+
+	clock.add(10 * time.Minute)
+	if _, locked := l.locked("jes"); locked {
+		t.Fatal("lockout should have expired")
+	}
+}
+
+func TestLimiterWindow(t *testing.T) {
+	clock := newFakeClock()
+	l := newLimiter(3, time.Minute, 10*time.Minute)
+	l.now = clock.now
+
+	// failures spread out over more than the window never lock
+	for i := 0; i < 10; i++ {
+		l.fail("jes")
+		clock.add(31 * time.Second)
+	}
+	if _, locked := l.locked("jes"); locked {
+		t.Fatal("failures outside the window should not lock")
+	}
+}
+
+func TestLimiterReset(t *testing.T) {
+	l := newLimiter(2, time.Minute, time.Minute)
+	l.fail("jes")
+	l.reset("jes")
+	l.fail("jes")
+	if _, locked := l.locked("jes"); locked {
+		t.Fatal("reset should forget earlier failures")
+	}
+}
@@ -0,0 +1,80 @@
+package reaper
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"git.j3s.sh/vore/rss"
+)
+
+// ItemFilter decides whether an item stays in a timeline.
+type ItemFilter func(i *rss.Item) bool
+
+// FilterItems narrows items down to the ones every filter keeps,
+// leaving their order alone. it goes between SortFeedItemsByDate
+// and TrimFuturePosts. items itself is never modified.
+func (r *Reaper) FilterItems(items []*rss.Item, filters ...ItemFilter) []*rss.Item {
+	if len(filters) == 0 {
+		return items
+	}
+	var result []*rss.Item
+outer:
+	for _, i := range items {
+		for _, keep := range filters {
+			if !keep(i) {
+				continue outer
+			}
+		}
+		result = append(result, i)
+	}
+	return result
+}
+
+// FromFeed keeps the items of the feed at url. it's a snapshot,
+// items the feed gains later on aren't kept.
+func (r *Reaper) FromFeed(url string) ItemFilter {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	// items don't know which feed they're from
+	items := make(map[*rss.Item]bool)
+	if f, ok := r.feeds[url]; ok {
+		for _, i := range f.Items {
+			items[i] = true
+		}
+	}
+	return func(i *rss.Item) bool {
+		return items[i]
+	}
+}
+
+// FromDomain keeps items that link to domain.
+func FromDomain(domain string) ItemFilter {
+	return func(i *rss.Item) bool {
+		u, err := url.Parse(i.Link)
+		return err == nil && strings.EqualFold(u.Hostname(), domain)
+	}
+}
+
+// Since keeps items published at t or later.
+func Since(t time.Time) ItemFilter {
+	return func(i *rss.Item) bool {
+		return !i.Date.Before(t)
+	}
+}
+
+// Until keeps items published before t.
+func Until(t time.Time) ItemFilter {
+	return func(i *rss.Item) bool {
+		return i.Date.Before(t)
+	}
+}
+
+// TitleContains keeps items whose title contains text,
+// ignoring case.
+func TitleContains(text string) ItemFilter {
+	text = strings.ToLower(text)
+	return func(i *rss.Item) bool {
+		return strings.Contains(strings.ToLower(i.Title), text)
+	}
+}
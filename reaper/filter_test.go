@@ -0,0 +1,48 @@
+package reaper
+
+import (
+	"testing"
+	"time"
+
+	"git.j3s.sh/vore/rss"
+	"git.j3s.sh/vore/sqlite"
+)
+
+func TestFilterItems(t *testing.T) {
+	r := newReaper(sqlite.NewMemory())
+	day := time.Date(2024, 4, 20, 0, 0, 0, 0, time.UTC)
+	cats := &rss.Feed{UpdateURL: "https://cats.example/feed", Items: []*rss.Item{
+		{Title: "A Cat", Link: "https://cats.example/1", Date: day.Add(2 * time.Hour)},
+		{Title: "another cat", Link: "https://cats.example/2", Date: day.Add(-time.Hour)},
+	}}
+	dogs := &rss.Feed{UpdateURL: "https://dogs.example/feed", Items: []*rss.Item{
+		{Title: "a dog", Link: "https://WWW.dogs.example/1", Date: day.Add(time.Hour)},
+		{Title: "a cat, sort of", Link: "not a url\x7f", Date: day},
+	}}
+	r.addFeed(cats)
+	r.addFeed(dogs)
+	items := r.SortFeedItemsByDate([]*rss.Feed{cats, dogs})
+	before := titles(items)
+
+	for _, tc := range []struct {
+		name    string
+		filters []ItemFilter
+		want    string
+	}{
+		{"none", nil, "A Cat,a dog,a cat, sort of,another cat"},
+		{"feed", []ItemFilter{r.FromFeed(dogs.UpdateURL)}, "a dog,a cat, sort of"},
+		{"unknown feed", []ItemFilter{r.FromFeed("https://nope.example/feed")}, ""},
+		{"domain", []ItemFilter{FromDomain("www.dogs.example")}, "a dog"},
+		{"since", []ItemFilter{Since(day)}, "A Cat,a dog,a cat, sort of"},
+		{"until", []ItemFilter{Until(day.Add(time.Hour))}, "a cat, sort of,another cat"},
+		{"title", []ItemFilter{TitleContains("CAT")}, "A Cat,a cat, sort of,another cat"},
+		{"all together", []ItemFilter{r.FromFeed(cats.UpdateURL), Since(day), TitleContains("cat")}, "A Cat"},
+	} {
+		if got := titles(r.FilterItems(items, tc.filters...)); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+	if titles(items) != before {
+		t.Fatal("filtering shouldn't touch the items it was given")
+	}
+}
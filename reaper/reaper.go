@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"maps"
 	"net/http"
+	"slices"
 	"sort"
 	"sync"
 	"time"
@@ -15,11 +17,49 @@ import (
 )
 
 type Reaper struct {
+	// mu guards feeds & the refresh bookkeeping below
+	mu sync.RWMutex
+
 	// internal list of all rss feeds where the map
 	// key represents the url of the feed (which should be unique)
 	feeds map[string]*rss.Feed
 
-	db *sqlite.DB
+	// refreshLocks has a lock per feed url, so that the workers
+	// & RefreshFeed never fetch the same feed at the same time.
+	// locks stay around after their feed is removed, in case a
+	// refresh is still holding one.
+	refreshLocks map[string]*sync.Mutex
+
+	db sqlite.Store
+
+	// wake cuts the reaper's nap short
+	wake chan struct{}
+
+	// tmu guards timelines, which has its own lock so that
+	// homepages don't queue up behind feed bookkeeping
+	tmu       sync.Mutex
+	timelines timelines
+
+	refreshing      bool
+	lastRefresh     time.Time
+	lastRefreshTook time.Duration
+	nextRefresh     time.Time
+}
+
+// refreshInterval is how long the reaper naps between refreshes
+const refreshInterval = 15 * time.Minute
+
+// Stats describes the reaper's refresh queue
+type Stats struct {
+	// Feeds is the number of feeds the reaper looks after
+	Feeds int
+	// Stale is the number of feeds due for a refresh
+	Stale int
+	// Refreshing is set while a refresh is running
+	Refreshing      bool
+	LastRefresh     time.Time
+	LastRefreshTook time.Duration
+	NextRefresh     time.Time
 }
 
 func (r *Reaper) fetchFunc() rss.FetchFunc {
@@ -47,17 +87,25 @@ func (r *Reaper) fetchFunc() rss.FetchFunc {
 	return reaperFetchFunc
 }
 
-func New(db *sqlite.DB) *Reaper {
-	r := &Reaper{
-		feeds: make(map[string]*rss.Feed),
-		db:    db,
-	}
+func New(db sqlite.Store) *Reaper {
+	r := newReaper(db)
 
 	go r.start()
 
 	return r
 }
 
+// newReaper is a reaper that hasn't been started
+func newReaper(db sqlite.Store) *Reaper {
+	return &Reaper{
+		feeds:        make(map[string]*rss.Feed),
+		refreshLocks: make(map[string]*sync.Mutex),
+		db:           db,
+		wake:         make(chan struct{}, 1),
+		timelines:    newTimelines(),
+	}
+}
+
 // Start initializes the reaper by populating a list of feeds from the database
 // and periodically refreshes all feeds every 15 minutes, if the feeds are
 // stale.
@@ -65,6 +113,7 @@ func New(db *sqlite.DB) *Reaper {
 func (r *Reaper) start() {
 	urls := r.db.GetAllFeedURLs()
 
+	r.mu.Lock()
 	for _, url := range urls {
 		// Setting UpdateURL lets us defer fetching
 		feed := &rss.Feed{
@@ -72,25 +121,46 @@ func (r *Reaper) start() {
 		}
 		r.feeds[url] = feed
 	}
+	r.mu.Unlock()
 
 	for {
 		start := time.Now()
 		log.Println("reaper: refreshing all feeds")
+		r.mu.Lock()
+		r.refreshing = true
+		r.mu.Unlock()
+
 		r.refreshAllFeeds()
-		log.Printf("reaper: refreshed all feeds in %s! going to sleep 😴\n", time.Since(start))
-		time.Sleep(15 * time.Minute)
+
+		took := time.Since(start)
+		r.mu.Lock()
+		r.refreshing = false
+		r.lastRefresh = start
+		r.lastRefreshTook = took
+		r.nextRefresh = time.Now().Add(refreshInterval)
+		r.mu.Unlock()
+		log.Printf("reaper: refreshed all feeds in %s! going to sleep 😴\n", took)
+
+		select {
+		case <-time.After(refreshInterval):
+		case <-r.wake:
+			log.Println("reaper: woken up early")
+		}
 	}
 }
 
 // Add the given rss feed to Reaper for maintenance.
 func (r *Reaper) addFeed(f *rss.Feed) {
+	r.mu.Lock()
 	r.feeds[f.UpdateURL] = f
+	r.mu.Unlock()
+	r.invalidateFeed(f.UpdateURL)
 }
 
 // UpdateAll fetches every feed & attempts updating them
 // asynchronously, then prints the duration of the sync
 func (r *Reaper) refreshAllFeeds() {
-	ch := make(chan *rss.Feed)
+	ch := make(chan string)
 	var wg sync.WaitGroup
 	// i chose 20 workers somewhat arbitrarily
 	for i := 20; i > 0; i-- {
@@ -99,32 +169,143 @@ func (r *Reaper) refreshAllFeeds() {
 		go func() {
 			defer wg.Done()
 
-			for f := range ch {
+			for url := range ch {
 				start := time.Now()
-				r.refreshFeed(f)
-				log.Printf("reaper: %s refreshed in %s\n", f.UpdateURL, time.Since(start))
+				r.refreshFeed(url, false)
+				log.Printf("reaper: %s refreshed in %s\n", url, time.Since(start))
 			}
 		}()
 	}
 
-	for i := range r.feeds {
-		if r.feeds[i].Stale() {
-			ch <- r.feeds[i]
-		}
+	for _, f := range r.staleFeeds() {
+		ch <- f.UpdateURL
 	}
 
 	close(ch)
 	wg.Wait()
 }
 
-// refreshFeed triggers a fetch on the given feed,
-// and sets a fetch error in the db if there is one.
-func (r *Reaper) refreshFeed(f *rss.Feed) {
-	f.FetchFunc = r.fetchFunc()
-	err := f.Update()
+// staleFeeds returns every feed that is due for a refresh
+func (r *Reaper) staleFeeds() []*rss.Feed {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var stale []*rss.Feed
+	for _, f := range r.feeds {
+		if f.Stale() {
+			stale = append(stale, f)
+		}
+	}
+	return stale
+}
+
+// refreshLock returns the lock for refreshing the feed at url
+func (r *Reaper) refreshLock(url string) *sync.Mutex {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	l, ok := r.refreshLocks[url]
+	if !ok {
+		l = &sync.Mutex{}
+		r.refreshLocks[url] = l
+	}
+	return l
+}
+
+// refreshFeed triggers a fetch on the feed at url, and sets a fetch
+// error in the db if there is one. a successful fetch clears any
+// previous fetch error. force fetches the feed even if it isn't
+// due for a refresh yet.
+//
+// feeds handed out by the reaper are never changed: the fetch works
+// on a copy, which replaces the feed once it's done. whoever already
+// has the old one keeps a consistent snapshot.
+func (r *Reaper) refreshFeed(url string, force bool) error {
+	l := r.refreshLock(url)
+	l.Lock()
+	defer l.Unlock()
+
+	r.mu.RLock()
+	f, ok := r.feeds[url]
+	r.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("reaper has no feed '%s'", url)
+	}
+	updated := *f
+	// Update appends to both of these, the old
+	// snapshot mustn't see that
+	updated.Items = slices.Clip(f.Items)
+	updated.ItemMap = maps.Clone(f.ItemMap)
+	if force {
+		// Update refuses to run before the feed's refresh time
+		updated.Refresh = time.Time{}
+	}
+	updated.FetchFunc = r.fetchFunc()
+	err := updated.Update()
 	if err != nil {
-		r.handleFeedFetchFailure(f.UpdateURL, err)
+		r.handleFeedFetchFailure(url, err)
+		return err
+	}
+	r.mu.Lock()
+	// the feed may have been removed or re-added meanwhile
+	if r.feeds[url] == f {
+		r.feeds[url] = &updated
+	}
+	r.mu.Unlock()
+	// updates only ever add items
+	if len(updated.Items) != len(f.Items) {
+		r.invalidateFeed(url)
+	}
+	err = r.db.SetFeedFetchError(url, "")
+	if err != nil {
+		log.Printf("reaper: could not clear feed fetch error '%s'\n", err)
+	}
+	return nil
+}
+
+// RefreshFeed fetches the given feed right away, even if
+// it isn't due for a refresh yet.
+func (r *Reaper) RefreshFeed(url string) error {
+	if !r.HasFeed(url) {
+		return fmt.Errorf("reaper has no feed '%s'", url)
+	}
+	return r.refreshFeed(url, true)
+}
+
+// RefreshAll wakes the reaper up to refresh every stale feed
+// without waiting out the rest of its nap. it doesn't wait for
+// the refresh to finish.
+func (r *Reaper) RefreshAll() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+		// a wakeup is already pending
+	}
+}
+
+// RemoveFeed stops the reaper from looking after the given feed.
+func (r *Reaper) RemoveFeed(url string) {
+	r.mu.Lock()
+	delete(r.feeds, url)
+	r.mu.Unlock()
+	r.invalidateFeed(url)
+}
+
+// Stats returns a snapshot of the reaper's refresh queue.
+func (r *Reaper) Stats() Stats {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	stats := Stats{
+		Feeds:           len(r.feeds),
+		Refreshing:      r.refreshing,
+		LastRefresh:     r.lastRefresh,
+		LastRefreshTook: r.lastRefreshTook,
+		NextRefresh:     r.nextRefresh,
+	}
+	for _, f := range r.feeds {
+		if f.Stale() {
+			stats.Stale++
+		}
 	}
+	return stats
 }
 
 func (r *Reaper) handleFeedFetchFailure(url string, err error) {
@@ -138,19 +319,27 @@ func (r *Reaper) handleFeedFetchFailure(url string, err error) {
 // HasFeed checks whether a given url is represented
 // in the reaper cache.
 func (r *Reaper) HasFeed(url string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	if _, ok := r.feeds[url]; ok {
 		return true
 	}
 	return false
 }
 
+// GetFeed returns the feed at url as it is right now. refreshes
+// replace it rather than change it, so it's safe to read at leisure.
 func (r *Reaper) GetFeed(url string) *rss.Feed {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	return r.feeds[url]
 }
 
 // GetItem recurses through all rss feeds, returning the first
 // found feed by matching against the provided link
 func (r *Reaper) GetItem(url string) (*rss.Item, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	for _, f := range r.feeds {
 		for _, i := range f.Items {
 			if i.Link == url {
@@ -165,10 +354,12 @@ func (r *Reaper) GetItem(url string) (*rss.Item, error) {
 func (r *Reaper) GetUserFeeds(username string) []*rss.Feed {
 	urls := r.db.GetUserFeedURLs(username)
 	var result []*rss.Feed
+	r.mu.RLock()
 	for _, u := range urls {
 		// feeds in the db are guaranteed to be in reaper
 		result = append(result, r.feeds[u])
 	}
+	r.mu.RUnlock()
 
 	r.SortFeeds(result)
 	return result
@@ -190,7 +381,7 @@ func (r *Reaper) SortFeedItemsByDate(feeds []*rss.Feed) []*rss.Item {
 	}
 
 	sort.Slice(posts, func(i, j int) bool {
-		return posts[i].Date.After(posts[j].Date)
+		return Precedes(posts[i], posts[j])
 	})
 	return posts
 }
@@ -8,7 +8,7 @@ import (
 )
 
 func TestHasFeed(t *testing.T) {
-	db := sqlite.New("go_test.db")
+	db := sqlite.NewMemory()
 	r := New(db)
 	f1 := rss.Feed{UpdateURL: "something"}
 	f2 := rss.Feed{UpdateURL: "strange"}
@@ -24,3 +24,18 @@ func TestHasFeed(t *testing.T) {
 		t.Fatal("reaper should have strange")
 	}
 }
+
+func TestRemoveFeed(t *testing.T) {
+	r := New(sqlite.NewMemory())
+	r.addFeed(&rss.Feed{UpdateURL: "something"})
+	if got := r.Stats().Feeds; got != 1 {
+		t.Fatalf("got %d feeds, want 1", got)
+	}
+	r.RemoveFeed("something")
+	if r.HasFeed("something") {
+		t.Fatal("removed feed should be gone")
+	}
+	if got := r.Stats().Feeds; got != 0 {
+		t.Fatalf("got %d feeds, want 0", got)
+	}
+}
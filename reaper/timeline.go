@@ -0,0 +1,119 @@
+package reaper
+
+import (
+	"git.j3s.sh/vore/rss"
+)
+
+// timelines caches every user's merged & sorted timeline, so a
+// homepage doesn't mean gathering & sorting thousands of items
+// every time it's looked at. a user's timeline is dropped when
+// one of their feeds gains items, or their subscriptions change,
+// and built again the next time it's asked for.
+type timelines struct {
+	// items is each user's timeline, future posts & all
+	items map[string][]*rss.Item
+	// feeds is the feed urls each cached timeline was built
+	// from, readers is the same thing the other way around
+	feeds   map[string][]string
+	readers map[string]map[string]bool
+	// generation goes up with every invalidation, so that a
+	// timeline built while one happened isn't cached
+	generation uint64
+}
+
+func newTimelines() timelines {
+	return timelines{
+		items:   make(map[string][]*rss.Item),
+		feeds:   make(map[string][]string),
+		readers: make(map[string]map[string]bool),
+	}
+}
+
+// TimelineKey orders items published at the same time. sorting on
+// the date alone would leave them in any old order, and anything
+// paging through a timeline needs it to hold still.
+func TimelineKey(i *rss.Item) string {
+	return i.Link + "\x00" + i.ID
+}
+
+// Precedes reports whether a comes before b in a timeline:
+// newest first, then by TimelineKey.
+func Precedes(a *rss.Item, b *rss.Item) bool {
+	if !a.Date.Equal(b.Date) {
+		return a.Date.After(b.Date)
+	}
+	return TimelineKey(a) < TimelineKey(b)
+}
+
+// UserTimeline is SortFeedItemsByDate(GetUserFeeds(username)),
+// from the cache when it can be. the result is shared, callers
+// mustn't modify it.
+func (r *Reaper) UserTimeline(username string) []*rss.Item {
+	r.tmu.Lock()
+	items, ok := r.timelines.items[username]
+	generation := r.timelines.generation
+	r.tmu.Unlock()
+	if ok {
+		return items
+	}
+
+	feeds := r.GetUserFeeds(username)
+	items = r.SortFeedItemsByDate(feeds)
+
+	r.tmu.Lock()
+	defer r.tmu.Unlock()
+	if r.timelines.generation != generation {
+		// something changed while we were sorting, it'll
+		// have to be built again next time
+		return items
+	}
+	var urls []string
+	for _, f := range feeds {
+		urls = append(urls, f.UpdateURL)
+		if r.timelines.readers[f.UpdateURL] == nil {
+			r.timelines.readers[f.UpdateURL] = make(map[string]bool)
+		}
+		r.timelines.readers[f.UpdateURL][username] = true
+	}
+	r.timelines.items[username] = items
+	r.timelines.feeds[username] = urls
+	return items
+}
+
+// InvalidateUser drops the user's cached timeline. it has to be
+// called whenever their subscriptions change.
+func (r *Reaper) InvalidateUser(username string) {
+	r.tmu.Lock()
+	defer r.tmu.Unlock()
+	r.invalidateUser(username)
+}
+
+// invalidateFeed drops the timeline of everybody reading the feed.
+func (r *Reaper) invalidateFeed(url string) {
+	r.tmu.Lock()
+	defer r.tmu.Unlock()
+	// readers changes as we go
+	var usernames []string
+	for username := range r.timelines.readers[url] {
+		usernames = append(usernames, username)
+	}
+	for _, username := range usernames {
+		r.invalidateUser(username)
+	}
+	// anybody who starts reading it has to build their
+	// timeline from scratch, so the generation still counts
+	r.timelines.generation++
+}
+
+// r.tmu must be held
+func (r *Reaper) invalidateUser(username string) {
+	for _, url := range r.timelines.feeds[username] {
+		delete(r.timelines.readers[url], username)
+		if len(r.timelines.readers[url]) == 0 {
+			delete(r.timelines.readers, url)
+		}
+	}
+	delete(r.timelines.items, username)
+	delete(r.timelines.feeds, username)
+	r.timelines.generation++
+}
@@ -0,0 +1,236 @@
+package reaper
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"git.j3s.sh/vore/rss"
+	"git.j3s.sh/vore/sqlite"
+)
+
+// newGrowingFeed serves a feed with as many items as n says
+func newGrowingFeed(t *testing.T, n *atomic.Int32) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var items strings.Builder
+		for i := range int(n.Load()) {
+			fmt.Fprintf(&items, `<item><title>post %d</title><link>%s/%d</link><pubDate>%s</pubDate></item>`,
+				i, "https://"+r.Host, i, time.Date(2006, 1, 2, 15, i, 0, 0, time.UTC).Format(time.RFC1123))
+		}
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprintf(w, `<rss version="2.0"><channel><title>feed</title>%s</channel></rss>`, items.String())
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func titles(items []*rss.Item) string {
+	var result []string
+	for _, i := range items {
+		result = append(result, i.Title)
+	}
+	return strings.Join(result, ",")
+}
+
+func TestUserTimelineCache(t *testing.T) {
+	db := sqlite.NewMemory()
+	r := newReaper(db)
+	var n, m atomic.Int32
+	n.Store(1)
+	m.Store(1)
+	first, second := newGrowingFeed(t, &n), newGrowingFeed(t, &m)
+	for _, u := range []string{first.URL, second.URL} {
+		if err := r.Fetch(u); err != nil {
+			t.Fatal(err)
+		}
+		db.WriteFeed(u)
+	}
+	for _, username := range []string{"jes", "bob"} {
+		if err := db.AddUser(username, "hunter2"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.BatchSubscribe("jes", []string{first.URL}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.BatchSubscribe("bob", []string{second.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	timeline := r.UserTimeline("jes")
+	if got := titles(timeline); got != "post 0" {
+		t.Fatalf("got %s", got)
+	}
+	if again := r.UserTimeline("jes"); &again[0] != &timeline[0] {
+		t.Fatal("the second look should come from the cache")
+	}
+	bobs := r.UserTimeline("bob")
+
+	// a feed gaining items only drops its own readers' timelines
+	n.Store(3)
+	if err := r.RefreshFeed(first.URL); err != nil {
+		t.Fatal(err)
+	}
+	if got := titles(r.UserTimeline("jes")); got != "post 2,post 1,post 0" {
+		t.Fatalf("after a refresh: got %s", got)
+	}
+	if again := r.UserTimeline("bob"); &again[0] != &bobs[0] {
+		t.Fatal("bob doesn't read the refreshed feed, that timeline should've stayed")
+	}
+
+	// a refresh with nothing new keeps the cache
+	timeline = r.UserTimeline("jes")
+	if err := r.RefreshFeed(first.URL); err != nil {
+		t.Fatal(err)
+	}
+	if again := r.UserTimeline("jes"); &again[0] != &timeline[0] {
+		t.Fatal("nothing changed, the timeline should've stayed")
+	}
+
+	// subscriptions live in the db, the reaper has to be told
+	if err := db.BatchSubscribe("jes", []string{first.URL, second.URL}); err != nil {
+		t.Fatal(err)
+	}
+	r.InvalidateUser("jes")
+	if got := len(r.UserTimeline("jes")); got != 4 {
+		t.Fatalf("after subscribing: got %d items, want 4", got)
+	}
+
+	r.RemoveFeed(second.URL)
+	if _, ok := r.timelines.items["bob"]; ok {
+		t.Fatal("removing a feed should drop its readers' timelines")
+	}
+	if _, ok := r.timelines.items["jes"]; ok {
+		t.Fatal("removing a feed should drop its readers' timelines")
+	}
+}
+
+// run with -race: admin refreshes, the workers & homepages
+// all get at the same feed
+func TestRefreshFeedWhileRefreshing(t *testing.T) {
+	db := sqlite.NewMemory()
+	r := newReaper(db)
+	var n atomic.Int32
+	n.Store(1)
+	feed := newGrowingFeed(t, &n)
+	if err := r.Fetch(feed.URL); err != nil {
+		t.Fatal(err)
+	}
+	db.WriteFeed(feed.URL)
+	if err := db.AddUser("jes", "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.BatchSubscribe("jes", []string{feed.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := range 10 {
+		n.Store(int32(i + 2))
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			r.RefreshFeed(feed.URL)
+		}()
+		go func() {
+			defer wg.Done()
+			r.refreshAllFeeds()
+		}()
+		go func() {
+			defer wg.Done()
+			r.UserTimeline("jes")
+		}()
+	}
+	wg.Wait()
+
+	if err := r.RefreshFeed(feed.URL); err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	for _, i := range r.UserTimeline("jes") {
+		if seen[i.Link] {
+			t.Fatalf("%s is in the timeline twice", i.Link)
+		}
+		seen[i.Link] = true
+	}
+	if len(seen) != 11 {
+		t.Fatalf("got %d items, want 11", len(seen))
+	}
+}
+
+// run with -race: feeds handed out earlier are read
+// while refreshes replace them
+func TestReadFeedWhileRefreshing(t *testing.T) {
+	db := sqlite.NewMemory()
+	r := newReaper(db)
+	var n atomic.Int32
+	n.Store(1)
+	feed := newGrowingFeed(t, &n)
+	if err := r.Fetch(feed.URL); err != nil {
+		t.Fatal(err)
+	}
+	db.WriteFeed(feed.URL)
+	if err := db.AddUser("jes", "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.BatchSubscribe("jes", []string{feed.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	old := r.GetFeed(feed.URL)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 10 {
+			n.Store(int32(i + 2))
+			r.RefreshFeed(feed.URL)
+		}
+	}()
+	read := func(f *rss.Feed) {
+		for _, i := range f.Items {
+			_ = f.Title + i.Title
+		}
+	}
+	for {
+		select {
+		case <-done:
+			if got := len(old.Items); got != 1 {
+				t.Fatalf("a feed handed out earlier changed, it has %d items", got)
+			}
+			if got := len(r.GetFeed(feed.URL).Items); got != 11 {
+				t.Fatalf("got %d items, want 11", got)
+			}
+			return
+		default:
+			read(old)
+			read(r.GetFeed(feed.URL))
+			for _, f := range r.GetUserFeeds("jes") {
+				read(f)
+			}
+		}
+	}
+}
+
+func TestSortFeedItemsByDateBreaksTies(t *testing.T) {
+	r := newReaper(sqlite.NewMemory())
+	date := time.Date(2024, 4, 20, 0, 0, 0, 0, time.UTC)
+	var items []*rss.Item
+	for i := range 4 {
+		items = append(items, &rss.Item{Title: fmt.Sprintf("post %d", i), Link: fmt.Sprintf("https://blog.example/%d", i), Date: date})
+	}
+	// same date, so the links decide, whatever order they came in
+	for _, feeds := range [][]*rss.Feed{
+		{{Items: items}},
+		{{Items: []*rss.Item{items[3], items[1]}}, {Items: []*rss.Item{items[2], items[0]}}},
+	} {
+		if got := titles(r.SortFeedItemsByDate(feeds)); got != "post 0,post 1,post 2,post 3" {
+			t.Fatalf("got %s", got)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// textSuffix asks for a page as plain text, for when
+	// setting an accept header is too much typing
+	textSuffix = ".txt"
+	// titles get cut off past this many characters in
+	// plain text, so that the columns after them line up
+	maxTextTitle = 60
+)
+
+// renderer writes out a page. renderPage writes html,
+// renderText writes plain text for terminals.
+type renderer func(w http.ResponseWriter, r *http.Request, page string, data any)
+
+// renderer picks how to render a page that comes in both html and
+// plain text. txt is set when the client asked for text by url.
+func (s *Site) renderer(w http.ResponseWriter, r *http.Request, txt bool) renderer {
+	w.Header().Add("Vary", "Accept")
+	if txt || prefersText(r.Header.Get("Accept")) {
+		return s.renderText
+	}
+	return s.renderPage
+}
+
+// prefersText reports whether an accept header would rather
+// have text/plain than text/html. anything vague, like curl's
+// */*, gets html.
+func prefersText(accept string) bool {
+	if accept == "" {
+		return false
+	}
+	var textQ, htmlQ float64
+	var textSpecific, htmlSpecific int
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if raw, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(raw, 64)
+			if err != nil {
+				continue
+			}
+		}
+		// the most specific range that matches a type decides its q
+		specific := 1
+		switch mediaType {
+		case "*/*":
+		case "text/*":
+			specific = 2
+		case "text/plain", "text/html":
+			specific = 3
+		default:
+			continue
+		}
+		if mediaType != "text/html" && specific > textSpecific {
+			textQ, textSpecific = q, specific
+		}
+		if mediaType != "text/plain" && specific > htmlSpecific {
+			htmlQ, htmlSpecific = q, specific
+		}
+	}
+	return textQ > htmlQ
+}
+
+// renderText is renderPage for terminals. pages come from
+// files/*.tmpl.txt, and tab separated columns are lined up.
+func (s *Site) renderText(w http.ResponseWriter, r *http.Request, page string, data any) {
+	// render to a buffer first, so that a broken
+	// template gets a 500 rather than half a page
+	text, err := s.executeText(page, s.pageData(r, page, data))
+	if err != nil {
+		s.renderErr(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(text)
+}
+
+// executeText runs one of the files/*.tmpl.txt pages
+// and lines up its columns
+func (s *Site) executeText(page string, data any) ([]byte, error) {
+	tmplFiles := filepath.Join("files", "*.tmpl.txt")
+	// finger answers with these too, which mustn't
+	// panic the whole process over a broken template
+	tmpl, err := template.New("whatever").Funcs(s.funcMap()).ParseGlob(tmplFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	err = tmpl.ExecuteTemplate(tw, page, data)
+	if err == nil {
+		err = tw.Flush()
+	}
+	return buf.Bytes(), err
+}
+
+// oneLine squashes text onto a single line, for formats
+// where a stray newline or tab would mean something. control
+// characters go too: feeds could otherwise send escape
+// sequences straight to somebody's terminal.
+func oneLine(text string) string {
+	text = strings.Map(func(r rune) rune {
+		// whitespace is left for Fields to squash
+		if unicode.IsControl(r) && !unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, text)
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// clip squashes a title onto one line and cuts it down to size,
+// so that the columns after it line up
+func clip(title string) string {
+	title = oneLine(title)
+	if utf8.RuneCountInString(title) <= maxTextTitle {
+		return title
+	}
+	runes := []rune(title)
+	return strings.TrimSpace(string(runes[:maxTextTitle-1])) + "…"
+}
+
+// safeLink is link squashed like oneLine, or nothing if it still
+// has a space in it: line based formats like gemtext put the link
+// text right after the link, so a space would split the two.
+func safeLink(link string) string {
+	link = oneLine(link)
+	if strings.ContainsRune(link, ' ') {
+		return ""
+	}
+	return link
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"git.j3s.sh/vore/sqlite"
+)
+
+func TestPrefersText(t *testing.T) {
+	for accept, want := range map[string]bool{
+		"":                      false,
+		"*/*":                   false,
+		"text/plain":            true,
+		"text/plain, */*;q=0.1": true,
+		"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8": false,
+		"text/html;q=0.5, text/plain":                                     true,
+		"text/*":                                                          false,
+		"text/*, text/html;q=0":                                           true,
+		"application/json":                                                false,
+		"text/plain;q=0, */*":                                             false,
+		"garbage;;;":                                                      false,
+	} {
+		if got := prefersText(accept); got != want {
+			t.Errorf("prefersText(%q) = %v, want %v", accept, got, want)
+		}
+	}
+}
+
+func TestClip(t *testing.T) {
+	if got := clip("a\ttitle\nwith  junk"); got != "a title with junk" {
+		t.Fatalf("got %q", got)
+	}
+	// escape sequences would be run by the reader's terminal
+	if got := clip("\x1b[2J\x1b]0;pwned\x07red\u009b31m \x00title\x7f"); got != "[2J]0;pwnedred31m title" {
+		t.Fatalf("got %q", got)
+	}
+	long := strings.Repeat("ö", maxTextTitle+10)
+	if got := clip(long); len([]rune(got)) != maxTextTitle || !strings.HasSuffix(got, "…") {
+		t.Fatalf("got %q", got)
+	}
+}
+
+// textDo is do with an accept header
+func textDo(h http.Handler, target string, accept string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", target, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestPlainTextPages(t *testing.T) {
+	s, h := newTestSite(t)
+	feed := newBigFeedServer(t, 3)
+	session := register(t, h, "jes", "correct horse")
+	do(h, "POST", "/settings/submit", url.Values{"submit": {feed.URL}}, session)
+	err := s.db.WriteSavedItem("jes", sqlite.SavedItem{
+		ItemURL:    "https://blog.example/0",
+		ItemTitle:  "post 0",
+		ArchiveURL: "https://archive.example/0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		target string
+		accept string
+		want   []string
+	}{
+		{"/jes", "text/plain", []string{"jes's vore", "post 0", "blog.example", "https://blog.example/2"}},
+		{"/jes.txt", "", []string{"jes's vore", "post 1"}},
+		{"/saves", "text/plain", []string{"jes's saves", "post 0", "https://archive.example/0"}},
+		{"/saves.txt", "", []string{"jes's saves"}},
+		{"/feeds/" + url.QueryEscape(feed.URL), "text/plain", []string{feed.URL, "big feed", "3 items"}},
+		{"/feeds/" + url.QueryEscape(feed.URL) + ".txt", "", []string{feed.URL, "post 2"}},
+	} {
+		w := textDo(h, tc.target, tc.accept, session)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: got status %d: %s", tc.target, w.Code, w.Body)
+			continue
+		}
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+			t.Errorf("%s: got content type %s", tc.target, ct)
+		}
+		body := w.Body.String()
+		if strings.Contains(body, "<") {
+			t.Errorf("%s: plain text shouldn't have markup:\n%s", tc.target, body)
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(body, want) {
+				t.Errorf("%s: missing %q in:\n%s", tc.target, want, body)
+			}
+		}
+	}
+
+	// columns line up, whatever the length of the title
+	w := textDo(h, "/jes.txt", "")
+	var offsets []int
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		if i := strings.Index(line, "https://"); i != -1 {
+			offsets = append(offsets, i)
+		}
+	}
+	if len(offsets) != 3 || offsets[0] != offsets[1] || offsets[1] != offsets[2] {
+		t.Fatalf("links should line up, got offsets %v:\n%s", offsets, w.Body)
+	}
+
+	w = textDo(h, "/jes", "text/html,*/*;q=0.8")
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Fatalf("browsers should still get html, got %s", ct)
+	}
+	if w.Header().Get("Vary") != "Accept" {
+		t.Fatal("negotiated pages should vary on accept")
+	}
+	if w := textDo(h, "/nobody.txt", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("unknown user: got status %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
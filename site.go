@@ -11,6 +11,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -31,26 +32,55 @@ type Site struct {
 	reaper *reaper.Reaper
 
 	// site database handle
-	db *sqlite.DB
+	db sqlite.Store
+
+	// behindTLSProxy is set when vore is served over https by a
+	// reverse proxy, which makes cookies https-only
+	behindTLSProxy bool
+
+	// who may create an account
+	registration registrationMode
+
+	// brute force protection for login & register
+	limiters limiters
+
+	// logins waiting on a two-factor code
+	challenges *challenges
+
+	// now is the clock two-factor codes are checked against
+	now func() time.Time
+
+	// archiver snapshots saved items
+	archiver archiver
 }
 
 type Save struct {
 	// inferred: user_id
 }
 
+// dbFile is the site database
+const dbFile = "vore.db"
+
+// dbPath is dbFile along with its pragmas:
+// - journal_mode=WAL: enable write-ahead log for concurrency & perf
+// - foreign_keys=ON: need foreign keyz
+// - busy_timeout=5000: locky locky 5 secs
+// - synchronous=NORMAL: "The synchronous=NORMAL setting is a good choice for most applications running in WAL mode."
+// - cache_size=-64000: 64MB ram for db cache (yum yum more perf)
+const dbPath = dbFile + "?_pragma=journal_mode(WAL)&_pragma=foreign_keys(ON)&_pragma=busy_timeout(5000)&_pragma=synchronous(NORMAL)&_pragma=cache_size(-64000)"
+
 // New returns a fully populated & ready for action Site
-func New() *Site {
-	// pragmas:
-	// - journal_mode=WAL: enable write-ahead log for concurrency & perf
-	// - foreign_keys=ON: need foreign keyz
-	// - busy_timeout=5000: locky locky 5 secs
-	// - synchronous=NORMAL: "The synchronous=NORMAL setting is a good choice for most applications running in WAL mode."
-	// - cache_size=-64000: 64MB ram for db cache (yum yum more perf)
-	db := sqlite.New("vore.db?_pragma=journal_mode(WAL)&_pragma=foreign_keys(ON)&_pragma=busy_timeout(5000)&_pragma=synchronous(NORMAL)&_pragma=cache_size(-64000)")
+// backed by the given store
+func New(db sqlite.Store) *Site {
 	s := Site{
-		title:  "vore",
-		reaper: reaper.New(db),
-		db:     db,
+		title:        "vore",
+		reaper:       reaper.New(db),
+		db:           db,
+		registration: registrationOpen,
+		limiters:     newLimiters(),
+		challenges:   newChallenges(challengeLifetime),
+		now:          time.Now,
+		archiver:     &wayback.Client{},
 	}
 	return &s
 }
@@ -83,40 +113,125 @@ func (s *Site) loginHandler(w http.ResponseWriter, r *http.Request) {
 			username := s.username(r)
 			http.Redirect(w, r, "/"+username, http.StatusSeeOther)
 		} else {
-			s.renderPage(w, r, "login", nil)
+			data := struct {
+				Registration registrationMode
+				Invite       string
+			}{
+				Registration: s.registration,
+				// invite links look like /login?invite=<code>
+				Invite: r.URL.Query().Get("invite"),
+			}
+			s.renderPage(w, r, "login", data)
 		}
 	}
 	if r.Method == "POST" {
 		username := r.FormValue("username")
 		password := r.FormValue("password")
 
-		err := s.login(w, username, password)
+		ipKey := s.clientIP(r)
+		accountKey := strings.ToLower(username)
+		for _, l := range []struct {
+			limiter *limiter
+			key     string
+		}{{s.limiters.loginIP, ipKey}, {s.limiters.loginAccount, accountKey}} {
+			if wait, locked := l.limiter.locked(l.key); locked {
+				s.tooManyAttempts(w, wait)
+				return
+			}
+		}
+
+		err := s.checkCredentials(username, password)
 		if err != nil {
+			s.limiters.loginIP.fail(ipKey)
+			s.limiters.loginAccount.fail(accountKey)
 			s.renderErr(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
+		// the account limiter isn't reset until the second
+		// factor checks out, or codes could be guessed forever
+		if s.db.GetTOTPSecret(username) != "" {
+			s.startChallenge(w, r, username)
+			return
+		}
+		err = s.startSession(w, r, username)
+		if err != nil {
+			s.renderErr(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.limiters.loginAccount.reset(accountKey)
 		http.Redirect(w, r, "/"+username, http.StatusSeeOther)
 	}
 }
 
-// TODO: make this take a POST only in accordance w/ some spec
 func (s *Site) logoutHandler(w http.ResponseWriter, r *http.Request) {
-	http.SetCookie(w, &http.Cookie{
-		Name:  "session_token",
-		Value: "",
+	// revoke the session server-side, so that the token
+	// is useless even if the cookie sticks around
+	if cookie, err := r.Cookie("session_token"); err == nil {
+		err := s.db.DeleteSession(lib.HashToken(cookie.Value))
+		if err != nil {
+			s.renderErr(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	s.setCookie(w, &http.Cookie{
+		Name:   "session_token",
+		Value:  "",
+		MaxAge: -1,
 	})
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
 func (s *Site) registerHandler(w http.ResponseWriter, r *http.Request) {
+	switch s.registration {
+	case registrationClosed:
+		s.renderErr(w, "registration is closed", http.StatusForbidden)
+		return
+	case registrationInvite:
+		if r.FormValue("invite") == "" {
+			s.renderErr(w, "registration is invite-only, you need an invite code", http.StatusForbidden)
+			return
+		}
+	}
+
+	// every attempt counts, successful or not
+	ipKey := s.clientIP(r)
+	if wait, locked := s.limiters.register.locked(ipKey); locked {
+		s.tooManyAttempts(w, wait)
+		return
+	}
+	s.limiters.register.fail(ipKey)
+
 	username := r.FormValue("username")
 	password := r.FormValue("password")
-	err := s.register(username, password)
+	err := s.validateUsername(username)
+	if err != nil {
+		s.renderErr(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = validatePassword(username, password)
+	if err != nil {
+		s.renderErr(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var invite string
+	if s.registration == registrationInvite {
+		invite = r.FormValue("invite")
+	}
+	err = s.register(username, password, invite)
+	if errors.Is(err, sqlite.ErrInvalidInvite) {
+		s.renderErr(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, errUsernameTaken) {
+		s.renderErr(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		s.renderErr(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	err = s.login(w, username, password)
+	err = s.login(w, r, username, password)
 	if err != nil {
 		s.renderErr(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -141,51 +256,98 @@ func (s *Site) saveHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	item, err := s.reaper.GetItem(decodedURL)
+	// vore.js only says "saved!" for a 2xx
+	_, err = s.save(username, decodedURL)
+	if errors.Is(err, errItemNotFound) {
+		s.renderErr(w, "no feed has an item linking to "+decodedURL, http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, errArchive) {
+		s.renderErr(w, err.Error(), http.StatusBadGateway)
+		return
+	}
 	if err != nil {
-		fmt.Fprintf(w, "error!")
+		s.renderErr(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+}
 
-	c := wayback.Client{}
+var (
+	errItemNotFound = errors.New("item not found")
+	errArchive      = errors.New("failed to archive")
+)
 
-	archiveURL, err := c.Archive(context.Background(), decodedURL)
+// archiver takes a snapshot of a page somewhere that
+// will outlive it, returning the snapshot's url
+type archiver interface {
+	Archive(ctx context.Context, url string) (string, error)
+}
+
+// save archives the item with the given link and
+// adds it to the user's saves
+func (s *Site) save(username string, itemURL string) (sqlite.SavedItem, error) {
+	item, err := s.reaper.GetItem(itemURL)
 	if err != nil {
-		log.Println(err)
-		fmt.Fprintf(w, "error capturing archive!!")
-		return
+		return sqlite.SavedItem{}, errItemNotFound
 	}
 
-	err = s.db.WriteSavedItem(username, sqlite.SavedItem{
+	archiveURL, err := s.archiver.Archive(context.Background(), itemURL)
+	if err != nil {
+		return sqlite.SavedItem{}, fmt.Errorf("%w: %s", errArchive, err)
+	}
+
+	saved := sqlite.SavedItem{
 		ArchiveURL: archiveURL,
 		ItemTitle:  item.Title,
 		ItemURL:    item.Link,
-	})
+		CreatedAt:  time.Now().UTC(),
+	}
+	err = s.db.WriteSavedItem(username, saved)
 	if err != nil {
-		log.Println(err)
-		fmt.Fprintf(w, "error!!!")
-		return
+		return sqlite.SavedItem{}, err
 	}
+	return saved, nil
 }
 
 func (s *Site) userHandler(w http.ResponseWriter, r *http.Request) {
 	username := r.PathValue("username")
 
+	// usernames can't have dots in them anymore, but
+	// old ones might, so only strip the suffix if it has to go
+	txt := false
+	if strings.HasSuffix(username, textSuffix) && !s.db.UserExists(username) {
+		username = strings.TrimSuffix(username, textSuffix)
+		txt = true
+	}
 	if !s.db.UserExists(username) {
 		http.NotFound(w, r)
 		return
 	}
 
-	items := s.reaper.TrimFuturePosts(s.reaper.SortFeedItemsByDate(s.reaper.GetUserFeeds(username)))
+	page, err := s.requestedPage(r, username, timelinePageSize)
+	if err != nil {
+		s.renderErr(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	data := struct {
-		User  string
-		Items []*rss.Item
+		User     string
+		Items    []*rss.Item
+		Filtered bool
+		Older    string
+		Newer    string
 	}{
-		User:  username,
-		Items: items,
+		User:     username,
+		Items:    page.Items,
+		Filtered: filtered(r),
+	}
+	if page.Older != "" {
+		data.Older = pageLink(r, "before", page.Older)
+	}
+	if page.Newer != "" {
+		data.Newer = pageLink(r, "after", page.Newer)
 	}
 
-	s.renderPage(w, r, "user", data)
+	s.renderer(w, r, txt)(w, r, "user", data)
 }
 
 func (s *Site) userSavesHandler(w http.ResponseWriter, r *http.Request) {
@@ -196,18 +358,54 @@ func (s *Site) userSavesHandler(w http.ResponseWriter, r *http.Request) {
 
 	username := s.username(r)
 	saves := s.db.GetUserSavedItems(username)
-	s.renderPage(w, r, "saves", saves)
+	txt := r.URL.Path == "/saves"+textSuffix
+	s.renderer(w, r, txt)(w, r, "saves", saves)
 }
 
 func (s *Site) settingsHandler(w http.ResponseWriter, r *http.Request) {
+	session, ok := s.session(r)
+	if !ok {
+		s.renderErr(w, "", http.StatusUnauthorized)
+		return
+	}
+
+	data := struct {
+		Feeds             []*rss.Feed
+		Sessions          []sqlite.Session
+		CurrentSession    int
+		TwoFactor         bool
+		RecoveryCodesLeft int
+		Tokens            []sqlite.APIToken
+	}{
+		Feeds:             s.reaper.GetUserFeeds(session.Username),
+		Sessions:          s.db.GetUserSessions(session.Username),
+		CurrentSession:    session.ID,
+		TwoFactor:         s.db.GetTOTPSecret(session.Username) != "",
+		RecoveryCodesLeft: s.db.RecoveryCodesLeft(session.Username),
+		Tokens:            s.db.GetUserAPITokens(session.Username),
+	}
+	s.renderPage(w, r, "settings", data)
+}
+
+// sessionRevokeHandler logs out one of the user's other devices
+func (s *Site) sessionRevokeHandler(w http.ResponseWriter, r *http.Request) {
 	if !s.loggedIn(r) {
 		s.renderErr(w, "", http.StatusUnauthorized)
 		return
 	}
 
-	var feeds []*rss.Feed
-	feeds = s.reaper.GetUserFeeds(s.username(r))
-	s.renderPage(w, r, "settings", feeds)
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		e := fmt.Sprintf("invalid session id '%s'", r.FormValue("id"))
+		s.renderErr(w, e, http.StatusBadRequest)
+		return
+	}
+	err = s.db.DeleteUserSession(s.username(r), id)
+	if err != nil {
+		s.renderErr(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
 }
 
 // TODO: show diff before submission (like tf plan)
@@ -219,9 +417,47 @@ func (s *Site) settingsSubmitHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err := s.setSubscriptions(s.username(r), strings.Split(r.FormValue("submit"), "\r\n"))
+	if errors.Is(err, errBadFeed) {
+		s.renderErr(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		s.renderErr(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
+
+// errBadFeed wraps anything wrong with a feed the user asked
+// to subscribe to, as opposed to anything wrong with vore
+var errBadFeed = errors.New("bad feed")
+
+// setSubscriptions replaces the user's subscriptions with the given
+// feed urls, fetching any feeds vore hasn't seen before. blank urls
+// are skipped.
+func (s *Site) setSubscriptions(username string, inputURLs []string) error {
+	validatedURLs, err := s.addFeeds(inputURLs)
+	if err != nil {
+		return err
+	}
+	err = s.db.BatchSubscribe(username, validatedURLs)
+	if err != nil {
+		log.Println(err)
+		return fmt.Errorf("reaper: can't batchsubscribe user=%s err=%s", username, err)
+	}
+	s.reaper.InvalidateUser(username)
+	return nil
+}
+
+// addFeeds makes sure the reaper & the db know about every feed
+// in inputURLs, fetching the new ones. it returns the urls that
+// were given, tidied up.
+func (s *Site) addFeeds(inputURLs []string) ([]string, error) {
 	// validate user input
 	var validatedURLs []string
-	for _, inputURL := range strings.Split(r.FormValue("submit"), "\r\n") {
+	for _, inputURL := range inputURLs {
 		inputURL = strings.TrimSpace(inputURL)
 		if inputURL == "" {
 			continue
@@ -233,9 +469,7 @@ func (s *Site) settingsSubmitHandler(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 		if _, err := url.ParseRequestURI(inputURL); err != nil {
-			e := fmt.Sprintf("can't parse url '%s': %s", inputURL, err)
-			s.renderErr(w, e, http.StatusBadRequest)
-			return
+			return nil, fmt.Errorf("%w: can't parse url '%s': %s", errBadFeed, inputURL, err)
 		}
 		validatedURLs = append(validatedURLs, inputURL)
 	}
@@ -248,22 +482,11 @@ func (s *Site) settingsSubmitHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		err := s.reaper.Fetch(u)
 		if err != nil {
-			e := fmt.Sprintf("reaper: can't fetch '%s' %s", u, err)
-			s.renderErr(w, e, http.StatusBadRequest)
-			return
+			return nil, fmt.Errorf("%w: reaper: can't fetch '%s' %s", errBadFeed, u, err)
 		}
 		s.db.WriteFeed(u)
 	}
-
-	err := s.db.BatchSubscribe(s.username(r), validatedURLs)
-	if err != nil {
-		log.Println(err)
-		e := fmt.Sprintf("reaper: can't batchsubscribe user=%s err=%s", s.username(r), err)
-		s.renderErr(w, e, http.StatusInternalServerError)
-		return
-	}
-
-	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+	return validatedURLs, nil
 }
 
 func (s *Site) feedDetailsHandler(w http.ResponseWriter, r *http.Request) {
@@ -274,6 +497,12 @@ func (s *Site) feedDetailsHandler(w http.ResponseWriter, r *http.Request) {
 		s.renderErr(w, e, http.StatusBadRequest)
 		return
 	}
+	// feed urls may well end in .txt themselves
+	txt := false
+	if strings.HasSuffix(decodedURL, textSuffix) && !s.reaper.HasFeed(decodedURL) {
+		decodedURL = strings.TrimSuffix(decodedURL, textSuffix)
+		txt = true
+	}
 	fetchErr, err := s.db.GetFeedFetchError(decodedURL)
 	if err != nil {
 		e := fmt.Sprintf("failed to fetch feed error '%s' %s", encodedURL, err)
@@ -289,7 +518,7 @@ func (s *Site) feedDetailsHandler(w http.ResponseWriter, r *http.Request) {
 		FetchFailure: fetchErr,
 	}
 
-	s.renderPage(w, r, "feedDetails", feedData)
+	s.renderer(w, r, txt)(w, r, "feedDetails", feedData)
 }
 
 func (s *Site) fingerHandler(w http.ResponseWriter, r *http.Request) {
@@ -345,7 +574,7 @@ func (s *Site) fingerHandler(w http.ResponseWriter, r *http.Request) {
     <meta charset="utf-8">
     <title>%s feeds</title>
 </head>
-<body style="font-family:sans-serif;">`, html.EscapeString(targetURL))
+<body>`, html.EscapeString(targetURL))
 
 		if len(feeds) == 0 {
 			fmt.Fprintln(w, `<p><em>No RSS/Atom feeds found</em></p>`)
@@ -393,19 +622,41 @@ func discoverFeeds(doc *html.Node, base *url.URL) []string {
 	return feeds
 }
 
+// sessionLifetime is how long a login lasts
+// before the user has to log in again
+const sessionLifetime = time.Hour * 24 * 365
+
+// session looks up the client's session based on the
+// session_token cookie that client has set. session
+// returns false if there is no valid session.
+func (s *Site) session(r *http.Request) (sqlite.Session, bool) {
+	cookie, err := r.Cookie("session_token")
+	if err != nil {
+		return sqlite.Session{}, false
+	}
+	session, ok := s.db.GetSession(lib.HashToken(cookie.Value))
+	if !ok {
+		return sqlite.Session{}, false
+	}
+	// don't write to the db on every single request
+	if time.Since(session.LastSeenAt) > 5*time.Minute {
+		err := s.db.TouchSession(session.ID)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+	return session, true
+}
+
 // username fetches a client's username based
 // on the sessionToken that user has set. username
-// will return "" if there is no sessionToken.
+// will return "" if there is no valid session.
 func (s *Site) username(r *http.Request) string {
-	cookie, err := r.Cookie("session_token")
-	if err == http.ErrNoCookie {
+	session, ok := s.session(r)
+	if !ok {
 		return ""
 	}
-	if err != nil {
-		log.Println(err)
-	}
-	username := s.db.GetUsernameBySessionToken(cookie.Value)
-	return username
+	return session.Username
 }
 
 func (s *Site) loggedIn(r *http.Request) bool {
@@ -415,94 +666,140 @@ func (s *Site) loggedIn(r *http.Request) bool {
 	return true
 }
 
-// login compares the sqlite password field against the user supplied password and
-// sets a session token against the supplied writer.
-func (s *Site) login(w http.ResponseWriter, username string, password string) error {
-	if username == "" {
-		return fmt.Errorf("username cannot be empty")
-	}
-	if password == "" {
-		return fmt.Errorf("password cannot be empty")
+// login compares the sqlite password field against the user supplied password,
+// starts a new session for the client's device and sets its token against the
+// supplied writer. it skips two-factor auth, so it's only for brand new users.
+func (s *Site) login(w http.ResponseWriter, r *http.Request, username string, password string) error {
+	err := s.checkCredentials(username, password)
+	if err != nil {
+		return err
 	}
-	if !s.db.UserExists(username) {
-		return fmt.Errorf("user '%s' does not exist", username)
+	return s.startSession(w, r, username)
+}
+
+// checkCredentials compares the sqlite password field
+// against the user supplied password
+func (s *Site) checkCredentials(username string, password string) error {
+	if username == "" || password == "" {
+		return errInvalidLogin
 	}
 	storedPassword := s.db.GetPassword(username)
+	if storedPassword == "" {
+		// burn the same time a real comparison would
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return errInvalidLogin
+	}
 	err := bcrypt.CompareHashAndPassword([]byte(storedPassword), []byte(password))
 	if err != nil {
-		return fmt.Errorf("invalid password")
+		return errInvalidLogin
+	}
+	if s.db.UserDisabled(username) {
+		return errAccountDisabled
 	}
-	sessionToken, err := s.db.GetSessionToken(username)
+	return nil
+}
+
+// startSession starts a new session for the client's device
+// and sets its token against the supplied writer
+func (s *Site) startSession(w http.ResponseWriter, r *http.Request, username string) error {
+	sessionToken := lib.GenerateSecureToken(32)
+	if sessionToken == "" {
+		return fmt.Errorf("could not generate a session token")
+	}
+	expires := time.Now().Add(sessionLifetime)
+	err := s.db.CreateSession(username, lib.HashToken(sessionToken), r.UserAgent(), expires)
 	if err != nil {
 		return err
 	}
-	if sessionToken == "" {
-		sessionToken = lib.GenerateSecureToken(32)
-		err := s.db.SetSessionToken(username, sessionToken)
-		if err != nil {
-			return err
-		}
+	// piggyback some housekeeping on logins
+	err = s.db.DeleteExpiredSessions()
+	if err != nil {
+		log.Println(err)
 	}
-	http.SetCookie(w, &http.Cookie{
+
+	s.setCookie(w, &http.Cookie{
 		Name:    "session_token",
-		Expires: time.Now().Add(time.Hour * 24 * 365),
+		Expires: expires,
 		Value:   sessionToken,
 	})
 	return nil
 }
 
-func (s *Site) register(username string, password string) error {
-	if s.db.UserExists(username) {
-		return fmt.Errorf("user '%s' already exists", username)
+// register creates a new user. if invite is set, one use of that
+// invite code is redeemed for the new user, or nobody is created.
+func (s *Site) register(username string, password string, invite string) error {
+	if s.db.UsernameTaken(username) {
+		return errUsernameTaken
 	}
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return err
 	}
 
-	err = s.db.AddUser(username, string(hashedPassword))
-	if err != nil {
-		return err
+	// the check above is just for a friendlier error, somebody
+	// could register the same name in the meantime
+	if invite != "" {
+		err = s.db.AddUserWithInvite(username, string(hashedPassword), invite)
+	} else {
+		err = s.db.AddUser(username, string(hashedPassword))
 	}
-	return nil
+	if errors.Is(err, sqlite.ErrUsernameTaken) {
+		return errUsernameTaken
+	}
+	return err
 }
 
 // renderPage renders the given page and passes data to the
 // template execution engine. it's normally the last thing a
 // handler should do tbh.
 func (s *Site) renderPage(w http.ResponseWriter, r *http.Request, page string, data any) {
-	funcMap := template.FuncMap{
+	tmplFiles := filepath.Join("files", "*.tmpl.html")
+	tmpl := template.Must(template.New("whatever").Funcs(s.funcMap()).ParseGlob(tmplFiles))
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := tmpl.ExecuteTemplate(w, page, s.pageData(r, page, data))
+	if err != nil {
+		s.renderErr(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// funcMap is every function templates may call
+func (s *Site) funcMap() map[string]any {
+	return map[string]any{
 		"printDomain": s.printDomain,
 		"timeSince":   s.timeSince,
 		"trimSpace":   strings.TrimSpace,
 		"escapeURL":   url.QueryEscape,
+		"oneLine":     oneLine,
+		"clip":        clip,
+		"safeLink":    safeLink,
 	}
+}
 
-	tmplFiles := filepath.Join("files", "*.tmpl.html")
-	tmpl := template.Must(template.New("whatever").Funcs(funcMap).ParseGlob(tmplFiles))
-
+// pageData wraps what the handler passes to its page
+// in everything the page's header & footer need
+func (s *Site) pageData(r *http.Request, page string, data any) any {
 	// fields on this anon struct are generally
 	// pulled out of Data when they're globally required
 	// callers should jam anything they want into Data
-	pageData := struct {
+	return struct {
 		Title      string
 		Username   string
 		LoggedIn   bool
 		CutePhrase string
+		CSRFToken  string
+		IsAdmin    bool
 		Data       any
 	}{
 		Title:      page,
 		Username:   s.username(r),
 		LoggedIn:   s.loggedIn(r),
 		CutePhrase: s.randomCutePhrase(),
+		CSRFToken:  csrfToken(r),
+		IsAdmin:    s.isAdmin(r),
 		Data:       data,
 	}
-
-	err := tmpl.ExecuteTemplate(w, page, pageData)
-	if err != nil {
-		s.renderErr(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
 }
 
 // printDomain does a best-effort uri parse, returning a string
@@ -559,6 +856,10 @@ func (s *Site) renderErr(w http.ResponseWriter, error string, code int) {
 		prefix = "400 bad request\n"
 	case http.StatusUnauthorized:
 		prefix = "401 unauthorized\n"
+	case http.StatusForbidden:
+		prefix = "403 forbidden\n"
+	case http.StatusTooManyRequests:
+		prefix = "429 too many requests\n"
 	case http.StatusInternalServerError:
 		prefix = "(╥﹏╥) oopsie woopsie, uwu\n"
 		prefix += "we made a fucky wucky (╥﹏╥)\n\n"
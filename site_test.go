@@ -0,0 +1,241 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"git.j3s.sh/vore/sqlite"
+)
+
+const testFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+<channel>
+	<title>test feed</title>
+	<link>https://blog.example</link>
+	<description>posts</description>
+	<item>
+		<title>hello from the test feed</title>
+		<link>https://blog.example/hello</link>
+		<pubDate>Mon, 02 Jan 2006 15:04:05 GMT</pubDate>
+	</item>
+</channel>
+</rss>`
+
+func newTestSite(t testing.TB) (*Site, http.Handler) {
+	t.Helper()
+	s := New(sqlite.NewMemory())
+	return s, s.handler()
+}
+
+// newFeedServer serves testFeed so that the reaper never
+// has to leave the machine
+func newFeedServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, testFeed)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// do sends a request through h. state-changing form posts get
+// a valid csrf token for whichever cookies they carry attached.
+func do(h http.Handler, method string, target string, form url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	if method != "GET" && form != nil && form.Get(csrfField) == "" {
+		secret := ""
+		for _, c := range cookies {
+			if c.Name == "session_token" {
+				secret = c.Value
+			}
+		}
+		if secret == "" {
+			secret = "anonymous"
+			cookies = append(cookies, &http.Cookie{Name: csrfCookie, Value: secret})
+		}
+		form.Set(csrfField, csrfTokenFor(secret))
+	}
+	return doRaw(h, method, target, form, cookies...)
+}
+
+// doRaw is do without any csrf help
+func doRaw(h http.Handler, method string, target string, form url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	var req *http.Request
+	if form != nil {
+		req = httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req = httptest.NewRequest(method, target, nil)
+	}
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+// register creates a user through the web form and returns
+// the session cookie that came back
+func register(t *testing.T, h http.Handler, username string, password string) *http.Cookie {
+	t.Helper()
+	w := do(h, "POST", "/register", url.Values{"username": {username}, "password": {password}})
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("register %s: got status %d: %s", username, w.Code, w.Body)
+	}
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "session_token" {
+			return c
+		}
+	}
+	t.Fatalf("register %s: no session cookie", username)
+	return nil
+}
+
+func TestUserHandlerUnknownUser(t *testing.T) {
+	_, h := newTestSite(t)
+	w := do(h, "GET", "/nobody", nil)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestLoggedOutPagesRequireAuth(t *testing.T) {
+	_, h := newTestSite(t)
+	for _, path := range []string{"/settings", "/saves"} {
+		w := do(h, "GET", path, nil)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: got status %d, want %d", path, w.Code, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestLoginWrongPassword(t *testing.T) {
+	_, h := newTestSite(t)
+	register(t, h, "jes", "correct horse")
+
+	w := do(h, "POST", "/login", url.Values{"username": {"jes"}, "password": {"battery staple"}})
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestSubscribeShowsItemsOnHomepage(t *testing.T) {
+	s, h := newTestSite(t)
+	feed := newFeedServer(t)
+	session := register(t, h, "jes", "correct horse")
+
+	w := do(h, "POST", "/settings/submit", url.Values{"submit": {feed.URL}}, session)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("settings submit: got status %d: %s", w.Code, w.Body)
+	}
+	if !s.reaper.HasFeed(feed.URL) {
+		t.Fatal("reaper should have the submitted feed")
+	}
+
+	w = do(h, "GET", "/settings", nil, session)
+	if !strings.Contains(w.Body.String(), feed.URL) {
+		t.Fatalf("settings page should list %s", feed.URL)
+	}
+
+	// homepages are public, no cookie needed
+	w = do(h, "GET", "/jes", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("homepage: got status %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "hello from the test feed") {
+		t.Fatal("homepage should contain the feed item")
+	}
+}
+
+func TestSaveFailures(t *testing.T) {
+	s, h := newTestSite(t)
+	feed := newFeedServer(t)
+	session := register(t, h, "jes", "correct horse")
+	do(h, "POST", "/settings/submit", url.Values{"submit": {feed.URL}}, session)
+	save := "/save/" + url.QueryEscape("https://blog.example/hello")
+
+	s.archiver = fakeArchiver{err: errors.New("wayback is down")}
+	if w := do(h, "POST", save, url.Values{}, session); w.Code != http.StatusBadGateway {
+		t.Fatalf("archive failure: got status %d, want %d", w.Code, http.StatusBadGateway)
+	}
+	s.archiver = fakeArchiver{}
+	if w := do(h, "POST", "/save/"+url.QueryEscape("https://blog.example/nope"), url.Values{}, session); w.Code != http.StatusNotFound {
+		t.Fatalf("unknown item: got status %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := do(h, "POST", save, url.Values{}, session); w.Code != http.StatusOK {
+		t.Fatalf("save: got status %d: %s", w.Code, w.Body)
+	}
+}
+
+// login logs an existing user in through the web form and
+// returns the session cookie that came back
+func login(t *testing.T, h http.Handler, username string, password string) *http.Cookie {
+	t.Helper()
+	w := do(h, "POST", "/login", url.Values{"username": {username}, "password": {password}})
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("login %s: got status %d: %s", username, w.Code, w.Body)
+	}
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "session_token" {
+			return c
+		}
+	}
+	t.Fatalf("login %s: no session cookie", username)
+	return nil
+}
+
+func TestLogoutRevokesSession(t *testing.T) {
+	_, h := newTestSite(t)
+	session := register(t, h, "jes", "correct horse")
+
+	w := do(h, "POST", "/logout", url.Values{}, session)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("logout: got status %d", w.Code)
+	}
+
+	// replaying the old cookie must not work anymore
+	w = do(h, "GET", "/settings", nil, session)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("got status %d with a logged out cookie, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestSessionPerDevice(t *testing.T) {
+	s, h := newTestSite(t)
+	laptop := register(t, h, "jes", "correct horse")
+	phone := login(t, h, "jes", "correct horse")
+	if laptop.Value == phone.Value {
+		t.Fatal("each login should get its own session token")
+	}
+
+	sessions := s.db.GetUserSessions("jes")
+	if len(sessions) != 2 {
+		t.Fatalf("got %d sessions, want 2", len(sessions))
+	}
+
+	// revoke the phone from the laptop
+	phoneSession, _ := s.session(requestWithCookie(phone))
+	w := do(h, "POST", "/settings/sessions/revoke", url.Values{"id": {fmt.Sprint(phoneSession.ID)}}, laptop)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("revoke: got status %d: %s", w.Code, w.Body)
+	}
+
+	if w := do(h, "GET", "/settings", nil, phone); w.Code != http.StatusUnauthorized {
+		t.Fatalf("revoked phone: got status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := do(h, "GET", "/settings", nil, laptop); w.Code != http.StatusOK {
+		t.Fatalf("laptop: got status %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func requestWithCookie(c *http.Cookie) *http.Request {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(c)
+	return r
+}
@@ -0,0 +1,102 @@
+package sqlite
+
+import (
+	"fmt"
+)
+
+// SetPassword replaces the user's password hash.
+func (db *DB) SetPassword(username string, passwordHash string) error {
+	res, err := db.sql.Exec(`UPDATE "user" SET password=? WHERE username=?`, passwordHash, username)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("user '%s' does not exist", username)
+	}
+	return nil
+}
+
+// DeleteUser deletes the user along with their subscriptions, saves,
+// sessions and invites. feeds that nobody subscribes to anymore are
+// deleted too, and their urls returned so that callers can forget
+// about them. everything happens in a single transaction.
+func (db *DB) DeleteUser(username string) ([]string, error) {
+	tx, err := db.sql.begin()
+	if err != nil {
+		return nil, err
+	}
+	// rollback is a no-op once the tx has been committed
+	defer tx.Rollback()
+
+	uid, err := userID(tx, username)
+	if err != nil {
+		return nil, fmt.Errorf("can't find user '%s': %w", username, err)
+	}
+
+	rows, err := tx.Query(`
+		SELECT f.url FROM feed f
+		JOIN subscribe s ON s.feed_id = f.id
+		WHERE s.user_id=?`, uid)
+	if err != nil {
+		return nil, err
+	}
+	var subscribed []string
+	for rows.Next() {
+		var url string
+		err = rows.Scan(&url)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		subscribed = append(subscribed, url)
+	}
+	rows.Close()
+
+	for _, q := range []string{
+		"DELETE FROM subscribe WHERE user_id=?",
+		"DELETE FROM saved_item WHERE user_id=?",
+		"DELETE FROM session WHERE user_id=?",
+		"DELETE FROM recovery_code WHERE user_id=?",
+		"DELETE FROM gemini_certificate WHERE token_id IN (SELECT id FROM api_token WHERE user_id=?)",
+		"DELETE FROM api_token WHERE user_id=?",
+		"DELETE FROM item_read WHERE user_id=?",
+		"DELETE FROM invite_redemption WHERE user_id=?",
+		// the user's invites go too, along with the record of
+		// who redeemed them. the redeemers' accounts stay.
+		"DELETE FROM invite_redemption WHERE invite_id IN (SELECT id FROM invite WHERE created_by=?)",
+		"DELETE FROM invite WHERE created_by=?",
+		`DELETE FROM "user" WHERE id=?`,
+	} {
+		_, err = tx.Exec(q, uid)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var orphaned []string
+	for _, url := range subscribed {
+		res, err := tx.Exec(`
+			DELETE FROM feed
+			WHERE url=? AND NOT EXISTS (SELECT 1 FROM subscribe WHERE subscribe.feed_id = feed.id)`, url)
+		if err != nil {
+			return nil, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			orphaned = append(orphaned, url)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return orphaned, nil
+}
@@ -0,0 +1,89 @@
+package sqlite
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDeleteUser(t *testing.T) {
+	testBackends(t, testDeleteUser)
+}
+
+func testDeleteUser(t *testing.T, db *DB) {
+	seed(t, db, "jes", "https://shared.example/feed", "https://jes.example/feed")
+	seed(t, db, "wesley", "https://shared.example/feed")
+	hour := time.Now().Add(time.Hour)
+	if err := db.CreateSession("jes", "laptop", "", hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.WriteSavedItem("jes", SavedItem{ItemURL: "u", ItemTitle: "t", ArchiveURL: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateInvite("jes", "code", 2, hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddUserWithInvite("forest", "hunter2", "code"); err != nil {
+		t.Fatal(err)
+	}
+	ids, err := db.NumberItems([]string{"https://jes.example/post"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetItemsRead("jes", []int64{ids["https://jes.example/post"]}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	orphaned, err := db.DeleteUser("jes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"https://jes.example/feed"}; !reflect.DeepEqual(orphaned, want) {
+		t.Fatalf("got orphaned feeds %v, want %v", orphaned, want)
+	}
+
+	if db.UserExists("jes") {
+		t.Fatal("jes should be gone")
+	}
+	if _, ok := db.GetSession("laptop"); ok {
+		t.Fatal("jes's sessions should be gone")
+	}
+	if _, exists := db.GetFeedIDAndExists("https://jes.example/feed"); exists {
+		t.Fatal("feed nobody reads anymore should be gone")
+	}
+	if _, exists := db.GetFeedIDAndExists("https://shared.example/feed"); !exists {
+		t.Fatal("feed wesley reads should stay")
+	}
+	if got := db.GetUserFeedURLs("wesley"); len(got) != 1 {
+		t.Fatalf("wesley's subscriptions should be untouched, got %v", got)
+	}
+	if !db.UserExists("forest") {
+		t.Fatal("users jes invited should stay")
+	}
+	var n int
+	db.sql.QueryRow("SELECT COUNT(*) FROM saved_item").Scan(&n)
+	if n != 0 {
+		t.Fatalf("got %d saved items, want 0", n)
+	}
+
+	if _, err := db.DeleteUser("jes"); err == nil {
+		t.Fatal("expected an error deleting a user twice")
+	}
+}
+
+func TestSetPassword(t *testing.T) {
+	testBackends(t, testSetPassword)
+}
+
+func testSetPassword(t *testing.T, db *DB) {
+	seed(t, db, "jes")
+	if err := db.SetPassword("jes", "new-hash"); err != nil {
+		t.Fatal(err)
+	}
+	if got := db.GetPassword("jes"); got != "new-hash" {
+		t.Fatalf("got password %q", got)
+	}
+	if err := db.SetPassword("nobody", "new-hash"); err == nil {
+		t.Fatal("expected an error for an unknown user")
+	}
+}
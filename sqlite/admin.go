@@ -0,0 +1,169 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// ErrFeedInUse is returned when deleting a feed that
+// somebody is still subscribed to.
+var ErrFeedInUse = errors.New("feed still has subscribers")
+
+// User is an account, as seen by admins.
+type User struct {
+	Username      string
+	IsAdmin       bool
+	Disabled      bool
+	Subscriptions int
+}
+
+// FeedInfo is a feed's bookkeeping, as seen by admins.
+type FeedInfo struct {
+	URL         string
+	FetchError  string
+	Subscribers int
+}
+
+// UserDisabled reports whether an admin has disabled the user.
+func (db *DB) UserDisabled(username string) bool {
+	var disabled bool
+	err := db.sql.QueryRow(`SELECT disabled FROM "user" WHERE username=?`, username).Scan(&disabled)
+	if err == sql.ErrNoRows {
+		return false
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	return disabled
+}
+
+// SetDisabled disables or re-enables the user. disabling
+// a user also revokes every one of their sessions.
+func (db *DB) SetDisabled(username string, disabled bool) error {
+	tx, err := db.sql.begin()
+	if err != nil {
+		return err
+	}
+	// rollback is a no-op once the tx has been committed
+	defer tx.Rollback()
+
+	uid, err := userID(tx, username)
+	if err != nil {
+		return fmt.Errorf("can't find user '%s': %w", username, err)
+	}
+	_, err = tx.Exec(`UPDATE "user" SET disabled=? WHERE id=?`, disabled, uid)
+	if err != nil {
+		return err
+	}
+	if disabled {
+		_, err = tx.Exec("DELETE FROM session WHERE user_id=?", uid)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetUsers returns every user along with
+// their subscription count, by username.
+func (db *DB) GetUsers() []User {
+	rows, err := db.sql.Query(`
+		SELECT u.username, u.is_admin, u.disabled, COUNT(s.id)
+		FROM "user" u
+		LEFT JOIN subscribe s ON s.user_id = u.id
+		GROUP BY u.id, u.username, u.is_admin, u.disabled
+		ORDER BY u.username`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var u User
+		err = rows.Scan(&u.Username, &u.IsAdmin, &u.Disabled, &u.Subscriptions)
+		if err != nil {
+			log.Fatal(err)
+		}
+		users = append(users, u)
+	}
+	return users
+}
+
+// GetFeeds returns every feed along with its last fetch
+// error and subscriber count, by url.
+func (db *DB) GetFeeds() []FeedInfo {
+	rows, err := db.sql.Query(`
+		SELECT f.url, f.fetch_error, COUNT(s.id)
+		FROM feed f
+		LEFT JOIN subscribe s ON s.feed_id = f.id
+		GROUP BY f.id, f.url, f.fetch_error
+		ORDER BY f.url`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+
+	var feeds []FeedInfo
+	for rows.Next() {
+		var f FeedInfo
+		var fetchErr sql.NullString
+		err = rows.Scan(&f.URL, &fetchErr, &f.Subscribers)
+		if err != nil {
+			log.Fatal(err)
+		}
+		f.FetchError = fetchErr.String
+		feeds = append(feeds, f)
+	}
+	return feeds
+}
+
+// DeleteFeed deletes a feed that nobody subscribes to. feeds with
+// subscribers are left alone, and ErrFeedInUse is returned.
+func (db *DB) DeleteFeed(feedURL string) error {
+	res, err := db.sql.Exec(`
+		DELETE FROM feed
+		WHERE url=? AND NOT EXISTS (SELECT 1 FROM subscribe WHERE subscribe.feed_id = feed.id)`, feedURL)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	if _, exists := db.GetFeedIDAndExists(feedURL); exists {
+		return ErrFeedInUse
+	}
+	return fmt.Errorf("feed '%s' does not exist", feedURL)
+}
+
+// GetRecentSavedItems returns the latest saves across
+// every user, newest first.
+func (db *DB) GetRecentSavedItems(limit int) []SavedItem {
+	rows, err := db.sql.Query(`
+		SELECT u.username, s.item_url, s.item_title, s.archive_url, s.created_at
+		FROM saved_item s
+		JOIN "user" u ON s.user_id = u.id
+		ORDER BY s.created_at DESC, s.id DESC
+		LIMIT ?`, limit)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+
+	var saves []SavedItem
+	for rows.Next() {
+		var si SavedItem
+		err = rows.Scan(&si.Username, &si.ItemURL, &si.ItemTitle, &si.ArchiveURL, &si.CreatedAt)
+		if err != nil {
+			log.Fatal(err)
+		}
+		saves = append(saves, si)
+	}
+	return saves
+}
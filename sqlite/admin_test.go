@@ -0,0 +1,102 @@
+package sqlite
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAdminQueries(t *testing.T) {
+	testBackends(t, testAdminQueries)
+}
+
+func testAdminQueries(t *testing.T, db *DB) {
+	seed(t, db, "jes", "https://a.example/feed", "https://b.example/feed")
+	seed(t, db, "wesley", "https://a.example/feed")
+	db.WriteFeed("https://orphan.example/feed")
+	err := db.SetFeedFetchError("https://b.example/feed", "404 not found")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := db.GetUsers()
+	if len(users) != 2 || users[0].Username != "jes" || users[0].Subscriptions != 2 || users[1].Subscriptions != 1 {
+		t.Fatalf("got users %+v", users)
+	}
+
+	feeds := make(map[string]FeedInfo)
+	for _, f := range db.GetFeeds() {
+		feeds[f.URL] = f
+	}
+	if f := feeds["https://a.example/feed"]; f.Subscribers != 2 || f.FetchError != "" {
+		t.Fatalf("got feed %+v", f)
+	}
+	if f := feeds["https://b.example/feed"]; f.FetchError != "404 not found" {
+		t.Fatalf("got feed %+v", f)
+	}
+	if f := feeds["https://orphan.example/feed"]; f.Subscribers != 0 {
+		t.Fatalf("got feed %+v", f)
+	}
+
+	err = db.DeleteFeed("https://a.example/feed")
+	if !errors.Is(err, ErrFeedInUse) {
+		t.Fatalf("got %v, want ErrFeedInUse", err)
+	}
+	err = db.DeleteFeed("https://orphan.example/feed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := db.GetFeedIDAndExists("https://orphan.example/feed"); exists {
+		t.Fatal("orphaned feed should be gone")
+	}
+	if err := db.DeleteFeed("https://nowhere.example/feed"); err == nil {
+		t.Fatal("expected an error deleting an unknown feed")
+	}
+
+	for _, title := range []string{"first", "second"} {
+		err := db.WriteSavedItem("wesley", SavedItem{
+			ItemURL:    "https://a.example/" + title,
+			ItemTitle:  title,
+			ArchiveURL: "https://archive.example/" + title,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	saves := db.GetRecentSavedItems(1)
+	if len(saves) != 1 || saves[0].Username != "wesley" || saves[0].ItemTitle != "second" {
+		t.Fatalf("got saves %+v", saves)
+	}
+}
+
+func TestSetDisabled(t *testing.T) {
+	testBackends(t, testSetDisabled)
+}
+
+func testSetDisabled(t *testing.T, db *DB) {
+	seed(t, db, "jes")
+	err := db.CreateSession("jes", "laptop", "", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.SetDisabled("jes", true); err != nil {
+		t.Fatal(err)
+	}
+	if !db.UserDisabled("jes") {
+		t.Fatal("jes should be disabled")
+	}
+	if _, ok := db.GetSession("laptop"); ok {
+		t.Fatal("disabling should revoke sessions")
+	}
+
+	if err := db.SetDisabled("jes", false); err != nil {
+		t.Fatal(err)
+	}
+	if db.UserDisabled("jes") {
+		t.Fatal("jes should be enabled again")
+	}
+	if err := db.SetDisabled("nobody", true); err == nil {
+		t.Fatal("expected an error disabling an unknown user")
+	}
+}
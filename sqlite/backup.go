@@ -0,0 +1,186 @@
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	backupPrefix = "vore-"
+	backupSuffix = ".db"
+	// sorts lexically in chronological order
+	backupTimeFormat = "20060102T150405.000Z"
+)
+
+// Backup writes a consistent snapshot of the running database into
+// dir with VACUUM INTO, which is safe to use while the database is
+// being written to in WAL mode. once the backup is written, all but
+// the newest keep backups in dir are deleted. keep <= 0 keeps
+// everything.
+//
+// Backup returns the path of the new backup.
+//
+// only sqlite databases can be backed up this way, postgres
+// has pg_dump for that.
+func (db *DB) Backup(dir string, keep int) (string, error) {
+	if db.sql.dialect != dialectSQLite {
+		return "", fmt.Errorf("can't back up a %s database, use its own tooling", db.sql.dialect)
+	}
+	err := os.MkdirAll(dir, 0o750)
+	if err != nil {
+		return "", err
+	}
+
+	name := backupPrefix + time.Now().UTC().Format(backupTimeFormat) + backupSuffix
+	path := filepath.Join(dir, name)
+	_, err = db.sql.Exec("VACUUM INTO ?", path)
+	if err != nil {
+		return "", fmt.Errorf("backup to %s failed: %w", path, err)
+	}
+
+	err = pruneBackups(dir, keep)
+	if err != nil {
+		return path, fmt.Errorf("backup written to %s, but pruning failed: %w", path, err)
+	}
+	return path, nil
+}
+
+// Backups lists the backups in dir, oldest first.
+func Backups(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var backups []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.Type().IsRegular() && strings.HasPrefix(name, backupPrefix) && strings.HasSuffix(name, backupSuffix) {
+			backups = append(backups, filepath.Join(dir, name))
+		}
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
+
+func pruneBackups(dir string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	backups, err := Backups(dir)
+	if err != nil {
+		return err
+	}
+	for len(backups) > keep {
+		err = os.Remove(backups[0])
+		if err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// Restore replaces the database file at dbFile with the backup at
+// backupPath. the backup must pass an integrity check and carry a
+// schema this build of vore understands, otherwise nothing is
+// touched. the database being replaced is kept next to it with a
+// ".pre-restore" suffix, along with its write-ahead log.
+//
+// Restore must not be run while vore is serving from dbFile.
+func Restore(backupPath string, dbFile string) error {
+	err := validateBackup(backupPath)
+	if err != nil {
+		return fmt.Errorf("refusing to restore %s: %w", backupPath, err)
+	}
+
+	// copy first so that the swap itself is a rename
+	tmp := dbFile + ".restore-tmp"
+	err = copyFile(backupPath, tmp)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	// the write-ahead log holds committed pages that may not have
+	// made it into the database file yet, so it moves along with
+	// it: sqlite pairs vore.db.pre-restore-wal with
+	// vore.db.pre-restore. it also mustn't be replayed onto the
+	// restored database.
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		// a log from an earlier restore would be
+		// replayed onto the wrong database
+		err = os.Remove(dbFile + ".pre-restore" + suffix)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			os.Remove(tmp)
+			return err
+		}
+		err = os.Rename(dbFile+suffix, dbFile+".pre-restore"+suffix)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	return os.Rename(tmp, dbFile)
+}
+
+func validateBackup(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	db, err := Open(path)
+	if err != nil {
+		return err
+	}
+	defer db.sql.Close()
+
+	var result string
+	err = db.sql.QueryRow("PRAGMA integrity_check").Scan(&result)
+	if err != nil {
+		return err
+	}
+	if result != "ok" {
+		return fmt.Errorf("integrity check failed: %s", result)
+	}
+
+	version, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if version == 0 {
+		return errors.New("not a vore database (no migrations recorded)")
+	}
+	// reuse the startup checks: a newer schema or
+	// edited migrations make the backup unusable
+	_, err = db.PendingMigrations()
+	return err
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o640)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	err = out.Sync()
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,152 @@
+package sqlite
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "vore.db")
+	db := New(dbFile)
+	seed(t, db, "jes", "https://a.example/feed")
+
+	backup, err := db.Backup(filepath.Join(dir, "backups"), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// diverge from the backup, then roll back to it
+	err = db.AddUser("wesley", "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.sql.Close()
+
+	err = Restore(backup, dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dbFile + ".pre-restore"); err != nil {
+		t.Fatalf("old database should be kept around: %s", err)
+	}
+
+	restored := New(dbFile)
+	defer restored.sql.Close()
+	if !restored.UserExists("jes") {
+		t.Fatal("restored database should have jes")
+	}
+	if restored.UserExists("wesley") {
+		t.Fatal("restored database should not have wesley")
+	}
+	if urls := restored.GetUserFeedURLs("jes"); len(urls) != 1 {
+		t.Fatalf("got subscriptions %v, want 1", urls)
+	}
+}
+
+func TestRestoreKeepsWriteAheadLog(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "vore.db")
+	db := New(dbFile + "?_pragma=journal_mode(WAL)")
+	// left open, as if vore had crashed, so wesley is
+	// only in the write-ahead log
+	defer db.sql.Close()
+	seed(t, db, "jes")
+
+	backup, err := db.Backup(filepath.Join(dir, "backups"), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.AddUser("wesley", "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dbFile + "-wal"); err != nil {
+		t.Fatalf("test needs a write-ahead log: %s", err)
+	}
+
+	err = Restore(backup, dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dbFile + "-wal"); err == nil {
+		t.Fatal("the old write-ahead log shouldn't be left for the restored database")
+	}
+
+	old := New(dbFile + ".pre-restore")
+	defer old.sql.Close()
+	if !old.UserExists("wesley") {
+		t.Fatal("the pre-restore copy lost what was in its write-ahead log")
+	}
+}
+
+func TestBackupRetention(t *testing.T) {
+	db := NewMemory()
+	dir := t.TempDir()
+
+	var last string
+	for i := 0; i < 5; i++ {
+		var err error
+		last, err = db.Backup(dir, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups, err := Backups(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("got %d backups, want 2", len(backups))
+	}
+	if backups[1] != last {
+		t.Fatalf("newest backup should be kept: got %s, want %s", backups[1], last)
+	}
+}
+
+func TestRestoreRejectsNewerSchema(t *testing.T) {
+	dir := t.TempDir()
+	db := NewMemory()
+	_, err := db.sql.Exec("INSERT INTO schema_migrations (version, checksum) VALUES (?, 'future')", db.LatestSchemaVersion()+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backup, err := db.Backup(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dbFile := filepath.Join(dir, "vore.db")
+	err = os.WriteFile(dbFile, []byte("original"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Restore(backup, dbFile); err == nil {
+		t.Fatal("expected restore of a newer schema to fail")
+	}
+	data, _ := os.ReadFile(dbFile)
+	if string(data) != "original" {
+		t.Fatal("failed restore should leave the database alone")
+	}
+}
+
+func TestRestoreRejectsNonVoreDatabase(t *testing.T) {
+	dir := t.TempDir()
+	other := filepath.Join(dir, "other.db")
+	db, err := Open(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.sql.Exec("CREATE TABLE hello (id INTEGER)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.sql.Close()
+
+	if err := Restore(other, filepath.Join(dir, "vore.db")); err == nil {
+		t.Fatal("expected restore of a non-vore database to fail")
+	}
+}
@@ -0,0 +1,143 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	gosqlite "github.com/glebarez/go-sqlite"
+	"github.com/lib/pq"
+)
+
+// dialect is the flavour of SQL spoken by the database behind a DB.
+// queries in this package are written once, sqlite-style with ?
+// placeholders, and rewritten for the dialect on their way out.
+type dialect int
+
+const (
+	dialectSQLite dialect = iota
+	dialectPostgres
+)
+
+// dialectFor picks a driver and dialect by DSN scheme. postgres://
+// and postgresql:// DSNs go to postgres, anything else is treated
+// as a sqlite path.
+func dialectFor(dsn string) (driver string, d dialect) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		return "postgres", dialectPostgres
+	}
+	return "sqlite", dialectSQLite
+}
+
+// String is also the name of the dialect's migrations directory
+func (d dialect) String() string {
+	switch d {
+	case dialectPostgres:
+		return "postgres"
+	default:
+		return "sqlite"
+	}
+}
+
+// isUniqueViolation reports whether err comes from a
+// unique constraint turning a write away, in either dialect
+func isUniqueViolation(err error) bool {
+	var sqliteErr *gosqlite.Error
+	if errors.As(err, &sqliteErr) {
+		// SQLITE_CONSTRAINT_UNIQUE & SQLITE_CONSTRAINT_PRIMARYKEY
+		return sqliteErr.Code() == 2067 || sqliteErr.Code() == 1555
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	return false
+}
+
+// rebind rewrites ? placeholders into the dialect's native
+// style. queries must not contain a literal ?.
+func (d dialect) rebind(query string) string {
+	if d != dialectPostgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// conn wraps *sql.DB so that every query is rebound
+// for the dialect before it reaches the driver
+type conn struct {
+	*sql.DB
+	dialect dialect
+}
+
+func (c *conn) Exec(query string, args ...any) (sql.Result, error) {
+	return c.DB.Exec(c.dialect.rebind(query), args...)
+}
+
+func (c *conn) Query(query string, args ...any) (*sql.Rows, error) {
+	return c.DB.Query(c.dialect.rebind(query), args...)
+}
+
+func (c *conn) QueryRow(query string, args ...any) *sql.Row {
+	return c.DB.QueryRow(c.dialect.rebind(query), args...)
+}
+
+// begin starts a transaction that rebinds like its conn
+func (c *conn) begin() (*tx, error) {
+	t, err := c.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &tx{Tx: t, dialect: c.dialect}, nil
+}
+
+type tx struct {
+	*sql.Tx
+	dialect dialect
+}
+
+func (t *tx) Exec(query string, args ...any) (sql.Result, error) {
+	return t.Tx.Exec(t.dialect.rebind(query), args...)
+}
+
+func (t *tx) Query(query string, args ...any) (*sql.Rows, error) {
+	return t.Tx.Query(t.dialect.rebind(query), args...)
+}
+
+func (t *tx) QueryRow(query string, args ...any) *sql.Row {
+	return t.Tx.QueryRow(t.dialect.rebind(query), args...)
+}
+
+// tableExists reports whether the named table exists
+func (db *DB) tableExists(name string) (bool, error) {
+	query := "SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name=?"
+	if db.sql.dialect == dialectPostgres {
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema=current_schema() AND table_name=?"
+	}
+	var n int
+	err := db.sql.QueryRow(query, name).Scan(&n)
+	return n > 0, err
+}
+
+// columnExists reports whether the named table has the named column
+func (db *DB) columnExists(table string, column string) (bool, error) {
+	query := "SELECT COUNT(*) FROM pragma_table_info(?) WHERE name=?"
+	if db.sql.dialect == dialectPostgres {
+		query = "SELECT COUNT(*) FROM information_schema.columns WHERE table_schema=current_schema() AND table_name=? AND column_name=?"
+	}
+	var n int
+	err := db.sql.QueryRow(query, table, column).Scan(&n)
+	return n > 0, err
+}
@@ -0,0 +1,134 @@
+package sqlite
+
+import (
+	"log"
+	"strings"
+)
+
+// NumberItems returns the number of every item guid, numbering the
+// ones that haven't been seen before in the order they're given.
+// items that already have a number are looked up without writing.
+func (db *DB) NumberItems(guids []string) (map[string]int64, error) {
+	ids, err := itemNumbers(db.sql, guids)
+	if err != nil {
+		return nil, err
+	}
+	var unseen []string
+	for _, guid := range guids {
+		if _, ok := ids[guid]; !ok {
+			unseen = append(unseen, guid)
+		}
+	}
+	if len(unseen) == 0 {
+		return ids, nil
+	}
+
+	tx, err := db.sql.begin()
+	if err != nil {
+		return nil, err
+	}
+	// rollback is a no-op once the tx has been committed
+	defer tx.Rollback()
+
+	for _, guid := range unseen {
+		// somebody else may have numbered it in the meantime
+		_, err = tx.Exec("INSERT INTO item (guid) VALUES (?) ON CONFLICT(guid) DO NOTHING", guid)
+		if err != nil {
+			return nil, err
+		}
+	}
+	numbered, err := itemNumbers(tx, unseen)
+	if err != nil {
+		return nil, err
+	}
+	for guid, id := range numbered {
+		ids[guid] = id
+	}
+	return ids, tx.Commit()
+}
+
+// itemLookupSize is how many guids itemNumbers asks about at
+// once, well under the limit on query parameters
+const itemLookupSize = 500
+
+// itemNumbers looks up the numbers of the guids that have one
+func itemNumbers(q querier, guids []string) (map[string]int64, error) {
+	ids := make(map[string]int64, len(guids))
+	for len(guids) > 0 {
+		n := min(len(guids), itemLookupSize)
+		args := make([]any, n)
+		for i, guid := range guids[:n] {
+			args[i] = guid
+		}
+		guids = guids[n:]
+
+		rows, err := q.Query("SELECT guid, id FROM item WHERE guid IN (?"+strings.Repeat(", ?", n-1)+")", args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var guid string
+			var id int64
+			err = rows.Scan(&guid, &id)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			ids[guid] = id
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// GetReadItems returns the numbers of every item the user has read.
+func (db *DB) GetReadItems(username string) map[int64]bool {
+	rows, err := db.sql.Query(`
+		SELECT r.item_id FROM item_read r
+		JOIN "user" u ON r.user_id = u.id
+		WHERE u.username=?`, username)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+
+	read := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+		if err != nil {
+			log.Fatal(err)
+		}
+		read[id] = true
+	}
+	return read
+}
+
+// SetItemsRead marks the numbered items as read or unread for the user.
+func (db *DB) SetItemsRead(username string, ids []int64, read bool) error {
+	tx, err := db.sql.begin()
+	if err != nil {
+		return err
+	}
+	// rollback is a no-op once the tx has been committed
+	defer tx.Rollback()
+
+	uid, err := userID(tx, username)
+	if err != nil {
+		return err
+	}
+	q := "DELETE FROM item_read WHERE user_id=? AND item_id=?"
+	if read {
+		q = "INSERT INTO item_read (user_id, item_id) VALUES (?, ?) ON CONFLICT DO NOTHING"
+	}
+	for _, id := range ids {
+		_, err = tx.Exec(q, uid, id)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
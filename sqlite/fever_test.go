@@ -0,0 +1,118 @@
+package sqlite
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestNumberItems(t *testing.T) {
+	testBackends(t, testNumberItems)
+}
+
+func testNumberItems(t *testing.T, db *DB) {
+	first, err := db.NumberItems([]string{"old", "new"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first["old"] >= first["new"] {
+		t.Fatalf("items should be numbered in order, got %v", first)
+	}
+
+	again, err := db.NumberItems([]string{"newest", "new", "old"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again["old"] != first["old"] || again["new"] != first["new"] {
+		t.Fatalf("numbers should stick, got %v then %v", first, again)
+	}
+	if again["newest"] <= first["new"] {
+		t.Fatalf("newly seen items should get bigger numbers, got %v", again)
+	}
+}
+
+func TestNumberItemsInBatches(t *testing.T) {
+	testBackends(t, testNumberItemsInBatches)
+}
+
+func testNumberItemsInBatches(t *testing.T, db *DB) {
+	var guids []string
+	for i := range itemLookupSize*2 + 1 {
+		guids = append(guids, fmt.Sprintf("post %d", i))
+	}
+	first, err := db.NumberItems(guids[:itemLookupSize])
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err := db.NumberItems(guids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != len(guids) {
+		t.Fatalf("got %d numbers, want %d", len(all), len(guids))
+	}
+	for i, guid := range guids {
+		if i < itemLookupSize && all[guid] != first[guid] {
+			t.Fatalf("%s: number changed from %d to %d", guid, first[guid], all[guid])
+		}
+		if i > 0 && all[guid] <= all[guids[i-1]] {
+			t.Fatalf("%s: items should be numbered in order", guid)
+		}
+	}
+}
+
+func TestItemsRead(t *testing.T) {
+	testBackends(t, testItemsRead)
+}
+
+func testItemsRead(t *testing.T, db *DB) {
+	seed(t, db, "jes")
+	seed(t, db, "wesley")
+	ids, err := db.NumberItems([]string{"a", "b", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b, c := ids["a"], ids["b"], ids["c"]
+
+	if err := db.SetItemsRead("jes", []int64{a, b}, true); err != nil {
+		t.Fatal(err)
+	}
+	// marking twice is fine
+	if err := db.SetItemsRead("jes", []int64{b, c}, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetItemsRead("jes", []int64{a}, false); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := db.GetReadItems("jes"), map[int64]bool{b: true, c: true}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got read items %v, want %v", got, want)
+	}
+	if got := db.GetReadItems("wesley"); len(got) != 0 {
+		t.Fatalf("wesley hasn't read anything, got %v", got)
+	}
+}
+
+func TestDeleteSavedItem(t *testing.T) {
+	testBackends(t, testDeleteSavedItem)
+}
+
+func testDeleteSavedItem(t *testing.T, db *DB) {
+	seed(t, db, "jes")
+	seed(t, db, "wesley")
+	for _, username := range []string{"jes", "wesley"} {
+		err := db.WriteSavedItem(username, SavedItem{ItemURL: "u", ItemTitle: "t", ArchiveURL: "a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.DeleteSavedItem("jes", "u"); err != nil {
+		t.Fatal(err)
+	}
+	if got := db.GetUserSavedItems("jes"); len(got) != 0 {
+		t.Fatalf("jes's save should be gone, got %v", got)
+	}
+	if got := db.GetUserSavedItems("wesley"); len(got) != 1 {
+		t.Fatalf("wesley's save should stay, got %v", got)
+	}
+}
@@ -0,0 +1,39 @@
+package sqlite
+
+import (
+	"log"
+	"time"
+)
+
+// LinkGeminiCertificate lets the certificate with the given
+// fingerprint act as the api token's owner, for as long as
+// the token lives. a certificate can only be linked once,
+// linking it again moves it to the new token.
+func (db *DB) LinkGeminiCertificate(tokenID int, fingerprint string) error {
+	_, err := db.sql.Exec(`
+		INSERT INTO gemini_certificate (token_id, fingerprint, created_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(fingerprint) DO UPDATE SET token_id=excluded.token_id, created_at=excluded.created_at`,
+		tokenID, fingerprint, time.Now().UTC())
+	return err
+}
+
+// GetGeminiCertificateToken returns the api token the certificate
+// was linked with. like the token itself, it doesn't work for
+// disabled users.
+func (db *DB) GetGeminiCertificateToken(fingerprint string) (APIToken, bool) {
+	rows, err := db.sql.Query(`
+		SELECT t.id, u.username, t.name, t.scope, t.created_at, t.last_used_at
+		FROM gemini_certificate c
+		JOIN api_token t ON c.token_id = t.id
+		JOIN "user" u ON t.user_id = u.id
+		WHERE c.fingerprint=? AND NOT u.disabled`, fingerprint)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tokens := scanAPITokens(rows)
+	if len(tokens) == 0 {
+		return APIToken{}, false
+	}
+	return tokens[0], true
+}
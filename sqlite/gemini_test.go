@@ -0,0 +1,59 @@
+package sqlite
+
+import "testing"
+
+func TestGeminiCertificates(t *testing.T) {
+	testBackends(t, testGeminiCertificates)
+}
+
+func testGeminiCertificates(t *testing.T, db *DB) {
+	seed(t, db, "jes")
+	seed(t, db, "wesley")
+	for _, tok := range []struct{ username, hash string }{{"jes", "hash-jes"}, {"wesley", "hash-wesley"}} {
+		if err := db.CreateAPIToken(tok.username, "gemini", tok.hash, "fever-"+tok.hash, "read"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	jes, _ := db.GetAPIToken("hash-jes")
+	wesley, _ := db.GetAPIToken("hash-wesley")
+
+	if _, ok := db.GetGeminiCertificateToken("laptop"); ok {
+		t.Fatal("unlinked certificate should not be found")
+	}
+	if err := db.LinkGeminiCertificate(jes.ID, "laptop"); err != nil {
+		t.Fatal(err)
+	}
+	if tok, ok := db.GetGeminiCertificateToken("laptop"); !ok || tok.Username != "jes" {
+		t.Fatalf("got token %+v", tok)
+	}
+
+	// linking again moves the certificate
+	if err := db.LinkGeminiCertificate(wesley.ID, "laptop"); err != nil {
+		t.Fatal(err)
+	}
+	if tok, _ := db.GetGeminiCertificateToken("laptop"); tok.Username != "wesley" {
+		t.Fatalf("certificate should belong to wesley now, got %+v", tok)
+	}
+
+	if err := db.SetDisabled("wesley", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := db.GetGeminiCertificateToken("laptop"); ok {
+		t.Fatal("disabled users' certificates should not work")
+	}
+
+	if err := db.LinkGeminiCertificate(jes.ID, "phone"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteUserAPIToken("jes", jes.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := db.GetGeminiCertificateToken("phone"); ok {
+		t.Fatal("revoking the token should unlink its certificates")
+	}
+
+	// deleting a user with linked certificates works
+	if _, err := db.DeleteUser("wesley"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,186 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ErrInvalidInvite is returned when an invite code doesn't exist,
+// has expired, or has been used up.
+var ErrInvalidInvite = errors.New("invalid or expired invite code")
+
+// Invite is a code that lets somebody register while
+// registration is invite-only.
+type Invite struct {
+	ID        int
+	Code      string
+	CreatedBy string
+	MaxUses   int
+	Uses      int
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	// RedeemedBy lists who registered with the invite, oldest first
+	RedeemedBy []Redemption
+}
+
+// Redemption is a single use of an invite code.
+type Redemption struct {
+	Username   string
+	RedeemedAt time.Time
+}
+
+// Usable reports whether the invite could still be redeemed at t.
+func (i Invite) Usable(t time.Time) bool {
+	return i.Uses < i.MaxUses && t.Before(i.ExpiresAt)
+}
+
+// IsAdmin reports whether the user is an administrator.
+func (db *DB) IsAdmin(username string) bool {
+	var admin bool
+	err := db.sql.QueryRow(`SELECT is_admin FROM "user" WHERE username=?`, username).Scan(&admin)
+	if err == sql.ErrNoRows {
+		return false
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	return admin
+}
+
+// SetAdmin grants or takes away the user's administrator role.
+func (db *DB) SetAdmin(username string, admin bool) error {
+	res, err := db.sql.Exec(`UPDATE "user" SET is_admin=? WHERE username=?`, admin, username)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("user '%s' does not exist", username)
+	}
+	return nil
+}
+
+// CreateInvite records a new invite code made by the given user.
+func (db *DB) CreateInvite(createdBy string, code string, maxUses int, expiresAt time.Time) error {
+	_, err := db.sql.Exec(`
+		INSERT INTO invite (code, created_by, max_uses, created_at, expires_at)
+		SELECT ?, id, ?, ?, ? FROM "user" WHERE username=?`,
+		code, maxUses, time.Now().UTC(), expiresAt.UTC(), createdBy)
+	return err
+}
+
+// GetInvites returns every invite along with its
+// redemptions, newest invite first.
+func (db *DB) GetInvites() []Invite {
+	rows, err := db.sql.Query(`
+		SELECT i.id, i.code, u.username, i.max_uses, i.uses, i.created_at, i.expires_at
+		FROM invite i
+		JOIN "user" u ON i.created_by = u.id
+		ORDER BY i.created_at DESC, i.id DESC`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+
+	var invites []Invite
+	index := make(map[int]int)
+	for rows.Next() {
+		var i Invite
+		err = rows.Scan(&i.ID, &i.Code, &i.CreatedBy, &i.MaxUses, &i.Uses, &i.CreatedAt, &i.ExpiresAt)
+		if err != nil {
+			log.Fatal(err)
+		}
+		index[i.ID] = len(invites)
+		invites = append(invites, i)
+	}
+	rows.Close()
+
+	rows, err = db.sql.Query(`
+		SELECT r.invite_id, u.username, r.redeemed_at
+		FROM invite_redemption r
+		JOIN "user" u ON r.user_id = u.id
+		ORDER BY r.redeemed_at, r.id`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var r Redemption
+		err = rows.Scan(&id, &r.Username, &r.RedeemedAt)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if i, ok := index[id]; ok {
+			invites[i].RedeemedBy = append(invites[i].RedeemedBy, r)
+		}
+	}
+	return invites
+}
+
+// ExpireInvite makes an invite unusable right away. it's kept
+// around so that its redemptions can still be looked up.
+func (db *DB) ExpireInvite(id int) error {
+	_, err := db.sql.Exec("UPDATE invite SET expires_at=? WHERE id=? AND expires_at > ?",
+		time.Now().UTC(), id, time.Now().UTC())
+	return err
+}
+
+// AddUserWithInvite creates a user, redeeming one use of the invite
+// code in the same transaction. if the code can't be redeemed, no
+// user is created and ErrInvalidInvite is returned.
+func (db *DB) AddUserWithInvite(username string, passwordHash string, code string) error {
+	tx, err := db.sql.begin()
+	if err != nil {
+		return err
+	}
+	// rollback is a no-op once the tx has been committed
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	var inviteID int
+	err = tx.QueryRow("SELECT id FROM invite WHERE code=?", code).Scan(&inviteID)
+	if err == sql.ErrNoRows {
+		return ErrInvalidInvite
+	}
+	if err != nil {
+		return err
+	}
+
+	// the use is claimed with a conditional update, so two people
+	// racing for the last use of a code can't both get it
+	res, err := tx.Exec(`
+		UPDATE invite SET uses = uses + 1
+		WHERE id=? AND uses < max_uses AND expires_at > ?`, inviteID, now)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrInvalidInvite
+	}
+
+	err = insertUser(tx, username, passwordHash)
+	if err != nil {
+		return err
+	}
+	uid, err := userID(tx, username)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO invite_redemption (invite_id, user_id, redeemed_at) VALUES (?, ?, ?)",
+		inviteID, uid, now)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,90 @@
+package sqlite
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestInvites(t *testing.T) {
+	testBackends(t, testInvites)
+}
+
+func testInvites(t *testing.T, db *DB) {
+	seed(t, db, "jes")
+	if db.IsAdmin("jes") {
+		t.Fatal("users should not be admins by default")
+	}
+	if err := db.SetAdmin("jes", true); err != nil {
+		t.Fatal(err)
+	}
+	if !db.IsAdmin("jes") {
+		t.Fatal("jes should be an admin")
+	}
+	if err := db.SetAdmin("nobody", true); err == nil {
+		t.Fatal("expected an error making an unknown user an admin")
+	}
+
+	week := time.Now().Add(7 * 24 * time.Hour)
+	if err := db.CreateInvite("jes", "twice", 2, week); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateInvite("jes", "stale", 1, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, u := range []string{"wesley", "forest"} {
+		if err := db.AddUserWithInvite(u, "hunter2", "twice"); err != nil {
+			t.Fatalf("%s: %s", u, err)
+		}
+	}
+
+	for code, user := range map[string]string{"twice": "third", "stale": "late", "nope": "guesser"} {
+		err := db.AddUserWithInvite(user, "hunter2", code)
+		if !errors.Is(err, ErrInvalidInvite) {
+			t.Errorf("code %s: got %v, want ErrInvalidInvite", code, err)
+		}
+		if db.UserExists(user) {
+			t.Errorf("code %s: %s should not have been created", code, user)
+		}
+	}
+
+	invites := db.GetInvites()
+	if len(invites) != 2 {
+		t.Fatalf("got %d invites, want 2", len(invites))
+	}
+	var twice Invite
+	for _, i := range invites {
+		if i.Code == "twice" {
+			twice = i
+		}
+	}
+	if twice.Uses != 2 || twice.CreatedBy != "jes" || twice.Usable(time.Now()) {
+		t.Fatalf("got invite %+v", twice)
+	}
+	if len(twice.RedeemedBy) != 2 || twice.RedeemedBy[0].Username != "wesley" || twice.RedeemedBy[1].Username != "forest" {
+		t.Fatalf("got redemptions %+v", twice.RedeemedBy)
+	}
+}
+
+func TestExpireInvite(t *testing.T) {
+	testBackends(t, testExpireInvite)
+}
+
+func testExpireInvite(t *testing.T, db *DB) {
+	seed(t, db, "jes")
+	if err := db.CreateInvite("jes", "code", 5, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	invite := db.GetInvites()[0]
+	if !invite.Usable(time.Now()) {
+		t.Fatal("new invite should be usable")
+	}
+	if err := db.ExpireInvite(invite.ID); err != nil {
+		t.Fatal(err)
+	}
+	err := db.AddUserWithInvite("wesley", "hunter2", "code")
+	if !errors.Is(err, ErrInvalidInvite) {
+		t.Fatalf("got %v, want ErrInvalidInvite", err)
+	}
+}
@@ -0,0 +1,271 @@
+package sqlite
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+)
+
+// migrations live in one directory per dialect. versions are
+// kept in lockstep across dialects, so a schema version means the
+// same thing no matter which database is behind vore.
+//
+//go:embed migrations/*/*.sql
+var migrationFiles embed.FS
+
+// Migration is a single schema change, loaded from
+// a file named like "<version>_<description>.sql"
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+	// Checksum is the hex sha256 of SQL. it's recorded alongside
+	// the version so that edits to already-applied migrations
+	// can be detected.
+	Checksum string
+}
+
+// loadMigrations reads every migration in dir, sorted by version
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	files, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	seen := make(map[int]string)
+	for _, f := range files {
+		var version int
+		_, err = fmt.Sscanf(f.Name(), "%d_", &version)
+		if err != nil {
+			return nil, fmt.Errorf("bad migration filename %s: %w", f.Name(), err)
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", other, f.Name(), version)
+		}
+		seen[version] = f.Name()
+
+		data, err := fs.ReadFile(fsys, path.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(data)
+		migrations = append(migrations, Migration{
+			Version:  version,
+			Name:     f.Name(),
+			SQL:      string(data),
+			Checksum: hex.EncodeToString(sum[:]),
+		})
+	}
+
+	// ReadDir sorts by filename, which puts 10_ before 2_
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+func embeddedMigrations(d dialect) ([]Migration, error) {
+	return loadMigrations(migrationFiles, path.Join("migrations", d.String()))
+}
+
+// LatestSchemaVersion is the newest schema version this build
+// knows about for the database's dialect.
+func (db *DB) LatestSchemaVersion() int {
+	migrations, err := embeddedMigrations(db.sql.dialect)
+	if err != nil || len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+// SchemaVersion returns the newest migration version recorded
+// in the database, or 0 if no migrations have been applied.
+func (db *DB) SchemaVersion() (int, error) {
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+	var version int
+	for v := range applied {
+		version = max(version, v)
+	}
+	return version, nil
+}
+
+// Migrate applies every pending migration. each migration and its
+// schema_migrations row are written in the same transaction, so a
+// crash can never leave a migration applied but unrecorded.
+//
+// Migrate refuses to touch a database whose schema is newer than
+// this build, or whose applied migrations have since been edited.
+func (db *DB) Migrate() error {
+	migrations, err := embeddedMigrations(db.sql.dialect)
+	if err != nil {
+		return err
+	}
+	return db.migrate(migrations)
+}
+
+// PendingMigrations returns the migrations that Migrate would apply,
+// without changing the database.
+func (db *DB) PendingMigrations() ([]Migration, error) {
+	migrations, err := embeddedMigrations(db.sql.dialect)
+	if err != nil {
+		return nil, err
+	}
+	return db.pendingMigrations(migrations)
+}
+
+func (db *DB) migrate(migrations []Migration) error {
+	err := db.createMigrationsTable()
+	if err != nil {
+		return err
+	}
+
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return err
+	}
+	pending, err := checkMigrations(migrations, applied)
+	if err != nil {
+		return err
+	}
+
+	// rows written before checksums existed get
+	// whatever is on disk today
+	for _, m := range migrations {
+		if sum, ok := applied[m.Version]; ok && !sum.Valid {
+			_, err := db.sql.Exec("UPDATE schema_migrations SET checksum=? WHERE version=?", m.Checksum, m.Version)
+			if err != nil {
+				return fmt.Errorf("failed to record checksum for %s: %w", m.Name, err)
+			}
+		}
+	}
+
+	for _, m := range pending {
+		err := db.applyMigration(m)
+		if err != nil {
+			return fmt.Errorf("failed to apply migration %s: %w", m.Name, err)
+		}
+		log.Printf("%s: applied migration %s\n", db.sql.dialect, m.Name)
+	}
+	return nil
+}
+
+func (db *DB) pendingMigrations(migrations []Migration) ([]Migration, error) {
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	return checkMigrations(migrations, applied)
+}
+
+func (db *DB) applyMigration(m Migration) error {
+	tx, err := db.sql.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(m.SQL)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO schema_migrations (version, checksum) VALUES (?, ?)", m.Version, m.Checksum)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// checkMigrations compares the known migrations against the ones
+// recorded in the database, and returns the ones still to apply.
+func checkMigrations(migrations []Migration, applied map[int]sql.NullString) ([]Migration, error) {
+	known := make(map[int]Migration)
+	latest := 0
+	for _, m := range migrations {
+		known[m.Version] = m
+		latest = max(latest, m.Version)
+	}
+
+	for version, sum := range applied {
+		if version > latest {
+			return nil, fmt.Errorf("database schema version %d is newer than this build of vore supports (%d), refusing to run", version, latest)
+		}
+		m, ok := known[version]
+		if !ok {
+			return nil, fmt.Errorf("database has migration version %d applied, but no such migration exists", version)
+		}
+		if sum.Valid && sum.String != m.Checksum {
+			return nil, fmt.Errorf("migration %s has been edited since it was applied (recorded checksum %s, now %s)", m.Name, sum.String, m.Checksum)
+		}
+	}
+
+	var pending []Migration
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; !ok {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+func (db *DB) createMigrationsTable() error {
+	_, err := db.sql.Exec("CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, checksum TEXT)")
+	if err != nil {
+		return err
+	}
+
+	// databases created before checksums were tracked
+	// have a schema_migrations table without the column
+	ok, err := db.columnExists("schema_migrations", "checksum")
+	if err != nil || ok {
+		return err
+	}
+	_, err = db.sql.Exec("ALTER TABLE schema_migrations ADD COLUMN checksum TEXT")
+	return err
+}
+
+// appliedMigrations maps every recorded migration version to its
+// checksum. a database without a schema_migrations table has
+// nothing applied.
+func (db *DB) appliedMigrations() (map[int]sql.NullString, error) {
+	applied := make(map[int]sql.NullString)
+
+	ok, err := db.tableExists("schema_migrations")
+	if err != nil || !ok {
+		return applied, err
+	}
+
+	hasChecksum, err := db.columnExists("schema_migrations", "checksum")
+	if err != nil {
+		return nil, err
+	}
+	query := "SELECT version, checksum FROM schema_migrations"
+	if !hasChecksum {
+		query = "SELECT version, NULL FROM schema_migrations"
+	}
+
+	rows, err := db.sql.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		var sum sql.NullString
+		err = rows.Scan(&version, &sum)
+		if err != nil {
+			return nil, err
+		}
+		applied[version] = sum
+	}
+	return applied, rows.Err()
+}
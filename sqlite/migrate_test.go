@@ -0,0 +1,179 @@
+package sqlite
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func mustEmbeddedMigrations(t *testing.T, db *DB) []Migration {
+	t.Helper()
+	migrations, err := embeddedMigrations(db.sql.dialect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return migrations
+}
+
+func TestLoadMigrationsSortsNumerically(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/10_ten.sql": {Data: []byte("SELECT 10;")},
+		"m/2_two.sql":  {Data: []byte("SELECT 2;")},
+		"m/1_one.sql":  {Data: []byte("SELECT 1;")},
+	}
+	migrations, err := loadMigrations(fsys, "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for _, m := range migrations {
+		got = append(got, m.Version)
+	}
+	if len(got) != 3 || got[0] != 1 || got[1] != 2 || got[2] != 10 {
+		t.Fatalf("got versions %v, want [1 2 10]", got)
+	}
+}
+
+func TestLoadMigrationsDuplicateVersion(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/1_one.sql":   {Data: []byte("SELECT 1;")},
+		"m/1_again.sql": {Data: []byte("SELECT 1;")},
+	}
+	if _, err := loadMigrations(fsys, "m"); err == nil {
+		t.Fatal("expected an error for duplicate versions")
+	}
+}
+
+func TestPendingMigrations(t *testing.T) {
+	testEmptyBackends(t, testPendingMigrations)
+}
+
+func testPendingMigrations(t *testing.T, db *DB) {
+	all := mustEmbeddedMigrations(t, db)
+
+	pending, err := db.PendingMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != len(all) {
+		t.Fatalf("got %d pending migrations on an empty db, want %d", len(pending), len(all))
+	}
+
+	// listing pending migrations must not create anything
+	if ok, _ := db.tableExists("schema_migrations"); ok {
+		t.Fatal("PendingMigrations should not create schema_migrations")
+	}
+
+	err = db.Migrate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending, err = db.PendingMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("got %d pending migrations after Migrate, want 0", len(pending))
+	}
+
+	version, err := db.SchemaVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != db.LatestSchemaVersion() {
+		t.Fatalf("got schema version %d, want %d", version, db.LatestSchemaVersion())
+	}
+}
+
+func TestMigrateDetectsEditedMigration(t *testing.T) {
+	testEmptyBackends(t, testMigrateDetectsEditedMigration)
+}
+
+func testMigrateDetectsEditedMigration(t *testing.T, db *DB) {
+	migrations := mustEmbeddedMigrations(t, db)
+	if err := db.migrate(migrations); err != nil {
+		t.Fatal(err)
+	}
+
+	migrations[0].SQL += "\n-- sneaky edit"
+	migrations[0].Checksum = "0000"
+	if err := db.migrate(migrations); err == nil {
+		t.Fatal("expected an error for an edited migration")
+	}
+}
+
+func TestMigrateRefusesNewerSchema(t *testing.T) {
+	testEmptyBackends(t, testMigrateRefusesNewerSchema)
+}
+
+func testMigrateRefusesNewerSchema(t *testing.T, db *DB) {
+	if err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := db.sql.Exec("INSERT INTO schema_migrations (version, checksum) VALUES (?, 'future')", db.LatestSchemaVersion()+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Migrate(); err == nil {
+		t.Fatal("expected Migrate to refuse a newer schema")
+	}
+}
+
+func TestMigrateFailureIsAtomic(t *testing.T) {
+	testEmptyBackends(t, testMigrateFailureIsAtomic)
+}
+
+func testMigrateFailureIsAtomic(t *testing.T, db *DB) {
+	migrations := append(mustEmbeddedMigrations(t, db), Migration{
+		Version:  1000,
+		Name:     "1000_broken.sql",
+		SQL:      "CREATE TABLE half_done (id INTEGER);\nSELECT nope FROM nowhere;",
+		Checksum: "broken",
+	})
+
+	if err := db.migrate(migrations); err == nil {
+		t.Fatal("expected the broken migration to fail")
+	}
+
+	if ok, _ := db.tableExists("half_done"); ok {
+		t.Fatal("the broken migration's table should have been rolled back")
+	}
+	var n int
+	db.sql.QueryRow("SELECT COUNT(*) FROM schema_migrations WHERE version=1000").Scan(&n)
+	if n != 0 {
+		t.Fatal("the broken migration should not be recorded")
+	}
+}
+
+// only sqlite databases predate checksums
+func TestMigrateBackfillsLegacyChecksums(t *testing.T) {
+	db := newEmptyDB(t)
+	migrations := mustEmbeddedMigrations(t, db)
+
+	// what a database looked like before checksums were tracked
+	_, err := db.sql.Exec("CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.sql.Exec(migrations[0].SQL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.sql.Exec("INSERT INTO schema_migrations (version) VALUES (?)", migrations[0].Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.migrate(migrations); err != nil {
+		t.Fatal(err)
+	}
+
+	var sum string
+	err = db.sql.QueryRow("SELECT checksum FROM schema_migrations WHERE version=?", migrations[0].Version).Scan(&sum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum != migrations[0].Checksum {
+		t.Fatalf("got checksum %q, want %q", sum, migrations[0].Checksum)
+	}
+}
@@ -0,0 +1,10 @@
+-- gemini has no cookies, clients identify themselves with a
+-- certificate instead. a certificate is linked to an account by
+-- pasting in one of the account's api tokens, and stops working
+-- when that token is revoked.
+CREATE TABLE IF NOT EXISTS gemini_certificate (
+    id SERIAL PRIMARY KEY,
+    token_id INTEGER NOT NULL REFERENCES api_token (id),
+    fingerprint TEXT UNIQUE NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
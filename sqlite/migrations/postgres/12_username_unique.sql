@@ -0,0 +1,15 @@
+-- usernames that only differ by case are turned away on registration,
+-- but two registrations racing each other could both get past that
+-- check. lower(username) can't get a unique index while older
+-- databases hold such users, so usernames are also kept lowercased in
+-- a column that can. users who already clash are left null there, and
+-- vore keeps reporting them on startup.
+ALTER TABLE "user" ADD COLUMN username_lower TEXT;
+
+UPDATE "user" SET username_lower = lower(username)
+WHERE lower(username) IN (
+    SELECT lower(username) FROM "user"
+    GROUP BY lower(username) HAVING count(*) = 1
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_username_lower_unique ON "user" (username_lower);
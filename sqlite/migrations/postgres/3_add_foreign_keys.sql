@@ -0,0 +1,15 @@
+-- unlike sqlite, postgres can add fk relationships in place
+ALTER TABLE subscribe
+ADD FOREIGN KEY (user_id) REFERENCES "user" (id),
+ADD FOREIGN KEY (feed_id) REFERENCES feed (id);
+
+ALTER TABLE saved_item
+ADD FOREIGN KEY (user_id) REFERENCES "user" (id);
+
+CREATE INDEX IF NOT EXISTS idx_subscribe_user_feed ON subscribe (user_id, feed_id);
+
+CREATE INDEX IF NOT EXISTS idx_saved_item_user ON saved_item (user_id);
+
+CREATE INDEX IF NOT EXISTS idx_saved_item_url ON saved_item (item_url);
+
+CREATE INDEX IF NOT EXISTS idx_saved_item_created ON saved_item (created_at);
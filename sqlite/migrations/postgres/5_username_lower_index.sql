@@ -0,0 +1,4 @@
+-- usernames are unique regardless of case. this can't be a unique
+-- index yet, since older databases may already hold users that only
+-- differ by case. vore reports those on startup.
+CREATE INDEX IF NOT EXISTS idx_user_username_lower ON "user" (lower(username));
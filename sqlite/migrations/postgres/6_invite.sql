@@ -0,0 +1,24 @@
+-- admins can hand out invite codes when registration is invite-only
+ALTER TABLE "user" ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- an invite code can be redeemed max_uses times before expires_at.
+-- codes are stored as-is so that admins can look them up again.
+CREATE TABLE IF NOT EXISTS invite (
+    id SERIAL PRIMARY KEY,
+    code TEXT UNIQUE NOT NULL,
+    created_by INTEGER NOT NULL REFERENCES "user" (id),
+    max_uses INTEGER NOT NULL,
+    uses INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+-- who signed up with which invite
+CREATE TABLE IF NOT EXISTS invite_redemption (
+    id SERIAL PRIMARY KEY,
+    invite_id INTEGER NOT NULL REFERENCES invite (id),
+    user_id INTEGER NOT NULL REFERENCES "user" (id),
+    redeemed_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_invite_redemption_invite ON invite_redemption (invite_id);
@@ -0,0 +1,13 @@
+-- personal api tokens for scripts. like sessions, only a hash of
+-- the token is stored. scope is either 'read' or 'write'.
+CREATE TABLE IF NOT EXISTS api_token (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES "user" (id),
+    name TEXT NOT NULL,
+    token_hash TEXT UNIQUE NOT NULL,
+    scope TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_token_user ON api_token (user_id);
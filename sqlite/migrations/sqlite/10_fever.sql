@@ -0,0 +1,23 @@
+-- fever clients log in with md5(username:password). vore never
+-- sees anybody's password, so api tokens stand in for it. this is
+-- the hash of the key a client would send with the token.
+ALTER TABLE api_token ADD COLUMN fever_key_hash TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_api_token_fever_key ON api_token (fever_key_hash);
+
+-- fever wants items numbered, and feeds don't number them. items
+-- get a number the first time a client asks about them, so newer
+-- items get bigger numbers.
+CREATE TABLE IF NOT EXISTS item (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    guid TEXT UNIQUE NOT NULL
+);
+
+-- items a user has marked as read from a fever client
+CREATE TABLE IF NOT EXISTS item_read (
+    user_id INTEGER NOT NULL,
+    item_id INTEGER NOT NULL,
+    PRIMARY KEY (user_id, item_id),
+    FOREIGN KEY (user_id) REFERENCES user (id),
+    FOREIGN KEY (item_id) REFERENCES item (id)
+);
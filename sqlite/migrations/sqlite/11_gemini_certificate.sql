@@ -0,0 +1,11 @@
+-- gemini has no cookies, clients identify themselves with a
+-- certificate instead. a certificate is linked to an account by
+-- pasting in one of the account's api tokens, and stops working
+-- when that token is revoked.
+CREATE TABLE IF NOT EXISTS gemini_certificate (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    token_id INTEGER NOT NULL,
+    fingerprint TEXT UNIQUE NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (token_id) REFERENCES api_token (id)
+);
@@ -0,0 +1,18 @@
+-- one row per logged in device. only a hash of the session
+-- token is stored, the token itself lives in the user's cookie.
+CREATE TABLE IF NOT EXISTS session (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    token_hash TEXT UNIQUE NOT NULL,
+    user_agent TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    last_seen_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES user (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_session_user ON session (user_id);
+
+-- the old single-token-per-user sessions never expired and
+-- can't be revoked, so everyone gets logged out once
+UPDATE user SET session_token = NULL;
@@ -0,0 +1,27 @@
+-- admins can hand out invite codes when registration is invite-only
+ALTER TABLE user ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- an invite code can be redeemed max_uses times before expires_at.
+-- codes are stored as-is so that admins can look them up again.
+CREATE TABLE IF NOT EXISTS invite (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    code TEXT UNIQUE NOT NULL,
+    created_by INTEGER NOT NULL,
+    max_uses INTEGER NOT NULL,
+    uses INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (created_by) REFERENCES user (id)
+);
+
+-- who signed up with which invite
+CREATE TABLE IF NOT EXISTS invite_redemption (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    invite_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    redeemed_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (invite_id) REFERENCES invite (id),
+    FOREIGN KEY (user_id) REFERENCES user (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_invite_redemption_invite ON invite_redemption (invite_id);
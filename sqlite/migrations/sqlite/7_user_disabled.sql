@@ -0,0 +1,3 @@
+-- admins can disable accounts. disabled users can't log in,
+-- and whatever sessions they had stop working.
+ALTER TABLE user ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,17 @@
+-- optional two-factor auth. totp_secret is NULL unless the user has
+-- enrolled. totp_last_step is the time step of the last code used,
+-- so that a code can't be replayed.
+ALTER TABLE user ADD COLUMN totp_secret TEXT;
+ALTER TABLE user ADD COLUMN totp_last_step INTEGER NOT NULL DEFAULT 0;
+
+-- one-time codes for when the authenticator is lost. like session
+-- tokens, only their hashes are stored.
+CREATE TABLE IF NOT EXISTS recovery_code (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES user (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_recovery_code_user ON recovery_code (user_id);
@@ -0,0 +1,14 @@
+-- personal api tokens for scripts. like sessions, only a hash of
+-- the token is stored. scope is either 'read' or 'write'.
+CREATE TABLE IF NOT EXISTS api_token (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    token_hash TEXT UNIQUE NOT NULL,
+    scope TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES user (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_token_user ON api_token (user_id);
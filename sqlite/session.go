@@ -0,0 +1,111 @@
+package sqlite
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// Session is a single logged in device. sessions are looked up by
+// the hash of their token, the token itself is never stored.
+type Session struct {
+	ID         int
+	Username   string
+	UserAgent  string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+}
+
+// CreateSession records a new session for the user, valid until expiresAt.
+func (db *DB) CreateSession(username string, tokenHash string, userAgent string, expiresAt time.Time) error {
+	now := time.Now().UTC()
+	_, err := db.sql.Exec(`
+		INSERT INTO session (user_id, token_hash, user_agent, created_at, last_seen_at, expires_at)
+		SELECT id, ?, ?, ?, ?, ? FROM "user" WHERE username=?`,
+		tokenHash, userAgent, now, now, expiresAt.UTC(), username)
+	return err
+}
+
+// GetSession looks up an unexpired session by its token hash.
+func (db *DB) GetSession(tokenHash string) (Session, bool) {
+	var s Session
+	err := db.sql.QueryRow(`
+		SELECT s.id, u.username, s.user_agent, s.created_at, s.last_seen_at, s.expires_at
+		FROM session s
+		JOIN "user" u ON s.user_id = u.id
+		WHERE s.token_hash=? AND NOT u.disabled`, tokenHash).
+		Scan(&s.ID, &s.Username, &s.UserAgent, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return Session{}, false
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !time.Now().Before(s.ExpiresAt) {
+		return Session{}, false
+	}
+	return s, true
+}
+
+// TouchSession bumps the session's last seen time to now.
+func (db *DB) TouchSession(id int) error {
+	_, err := db.sql.Exec("UPDATE session SET last_seen_at=? WHERE id=?", time.Now().UTC(), id)
+	return err
+}
+
+// GetUserSessions returns every unexpired session belonging
+// to the user, most recently seen first.
+func (db *DB) GetUserSessions(username string) []Session {
+	rows, err := db.sql.Query(`
+		SELECT s.id, u.username, s.user_agent, s.created_at, s.last_seen_at, s.expires_at
+		FROM session s
+		JOIN "user" u ON s.user_id = u.id
+		WHERE u.username = ? AND s.expires_at > ?
+		ORDER BY s.last_seen_at DESC`, username, time.Now().UTC())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var s Session
+		err = rows.Scan(&s.ID, &s.Username, &s.UserAgent, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions
+}
+
+// DeleteSession revokes the session with the given token hash.
+func (db *DB) DeleteSession(tokenHash string) error {
+	_, err := db.sql.Exec("DELETE FROM session WHERE token_hash=?", tokenHash)
+	return err
+}
+
+// DeleteUserSession revokes one of the user's sessions by id. sessions
+// belonging to other users are left alone.
+func (db *DB) DeleteUserSession(username string, id int) error {
+	_, err := db.sql.Exec(`
+		DELETE FROM session
+		WHERE id=? AND user_id=(SELECT id FROM "user" WHERE username=?)`, id, username)
+	return err
+}
+
+// DeleteOtherUserSessions revokes every one of the user's
+// sessions except the one with id keepID.
+func (db *DB) DeleteOtherUserSessions(username string, keepID int) error {
+	_, err := db.sql.Exec(`
+		DELETE FROM session
+		WHERE id<>? AND user_id=(SELECT id FROM "user" WHERE username=?)`, keepID, username)
+	return err
+}
+
+// DeleteExpiredSessions garbage collects sessions that can no longer be used.
+func (db *DB) DeleteExpiredSessions() error {
+	_, err := db.sql.Exec("DELETE FROM session WHERE expires_at <= ?", time.Now().UTC())
+	return err
+}
@@ -0,0 +1,100 @@
+package sqlite
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessions(t *testing.T) {
+	testBackends(t, testSessions)
+}
+
+func testSessions(t *testing.T, db *DB) {
+	seed(t, db, "jes")
+	seed(t, db, "wesley")
+	hour := time.Now().Add(time.Hour)
+
+	for _, hash := range []string{"laptop", "phone"} {
+		err := db.CreateSession("jes", hash, hash+" agent", hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := db.CreateSession("wesley", "wesleys-phone", "", hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	laptop, ok := db.GetSession("laptop")
+	if !ok {
+		t.Fatal("laptop session should exist")
+	}
+	if laptop.Username != "jes" || laptop.UserAgent != "laptop agent" {
+		t.Fatalf("got session %+v", laptop)
+	}
+	if _, ok := db.GetSession("nope"); ok {
+		t.Fatal("unknown token hash should not have a session")
+	}
+	if got := len(db.GetUserSessions("jes")); got != 2 {
+		t.Fatalf("got %d sessions for jes, want 2", got)
+	}
+
+	// jes can't revoke wesley's session by guessing its id
+	wesleys, _ := db.GetSession("wesleys-phone")
+	err = db.DeleteUserSession("jes", wesleys.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := db.GetSession("wesleys-phone"); !ok {
+		t.Fatal("jes should not be able to revoke wesley's session")
+	}
+
+	err = db.DeleteUserSession("jes", laptop.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := db.GetSession("laptop"); ok {
+		t.Fatal("revoked session should be gone")
+	}
+
+	err = db.DeleteSession("phone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(db.GetUserSessions("jes")); got != 0 {
+		t.Fatalf("got %d sessions for jes after logging out everywhere, want 0", got)
+	}
+}
+
+func TestExpiredSessions(t *testing.T) {
+	testBackends(t, testExpiredSessions)
+}
+
+func testExpiredSessions(t *testing.T, db *DB) {
+	seed(t, db, "jes")
+	err := db.CreateSession("jes", "stale", "", time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.CreateSession("jes", "fresh", "", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := db.GetSession("stale"); ok {
+		t.Fatal("expired session should not be usable")
+	}
+	if got := len(db.GetUserSessions("jes")); got != 1 {
+		t.Fatalf("got %d sessions, want only the unexpired one", got)
+	}
+
+	err = db.DeleteExpiredSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	db.sql.QueryRow("SELECT COUNT(*) FROM session").Scan(&n)
+	if n != 1 {
+		t.Fatalf("got %d session rows after cleanup, want 1", n)
+	}
+}
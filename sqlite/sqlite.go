@@ -2,21 +2,25 @@ package sqlite
 
 import (
 	"database/sql"
-	"embed"
+	"errors"
 	"fmt"
-	"io/fs"
 	"log"
-	"strings"
 	"time"
-
-	_ "github.com/glebarez/go-sqlite"
 )
 
-//go:embed migrations/*.sql
-var migrationFiles embed.FS
-
+// DB is vore's database handle. despite the package name it can
+// be backed by sqlite or postgres, see Open.
 type DB struct {
-	sql *sql.DB
+	sql *conn
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx. helpers that take
+// a querier can be composed inside a transaction so that multi-statement
+// operations either fully apply or not at all.
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
 }
 
 type SavedItem struct {
@@ -24,78 +28,59 @@ type SavedItem struct {
 	CreatedAt  time.Time
 	ItemTitle  string
 	ItemURL    string
+	// Username is only filled in by GetRecentSavedItems
+	Username string
 }
 
-// New opens a sqlite database, populates it with tables, and
+// New opens a database, populates it with tables, and
 // returns a ready-to-use *sqlite.DB object which is used for
 // abstracting database queries.
-func New(path string) *DB {
-	db, err := sql.Open("sqlite", path)
+func New(dsn string) *DB {
+	db, err := Open(dsn)
 	if err != nil {
 		log.Fatal(err)
 	}
-
-	_, err = db.Exec("CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)")
+	err = db.Migrate()
 	if err != nil {
 		log.Fatal(err)
 	}
+	return db
+}
 
-	var latestVersion int
-	row := db.QueryRow("SELECT MAX(version) FROM schema_migrations")
-	err = row.Scan(&latestVersion)
+// NewMemory returns a *sqlite.DB backed by a private in-memory
+// database. nothing touches the filesystem, which makes it a
+// good fit for tests.
+func NewMemory() *DB {
+	db, err := Open(":memory:?_pragma=foreign_keys(ON)")
 	if err != nil {
-		if strings.Contains(err.Error(), "converting NULL to int is unsupported") {
-			// assume that we're starting from ground zero
-			latestVersion = 0
-		} else {
-			log.Fatal(err)
-		}
+		log.Fatal(err)
 	}
-
-	files, err := fs.ReadDir(migrationFiles, "migrations")
+	// every new connection to :memory: gets its own empty
+	// database, so pin the pool to exactly one connection
+	db.sql.SetMaxOpenConns(1)
+	err = db.Migrate()
 	if err != nil {
 		log.Fatal(err)
 	}
-	for _, f := range files {
-		var version int
-		_, err = fmt.Sscanf(f.Name(), "%d_", &version)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		// Apply migration if not already applied
-		if version > latestVersion {
-			fileData, _ := fs.ReadFile(migrationFiles, "migrations/"+f.Name())
-			_, err := db.Exec(string(fileData))
-			if err != nil {
-				log.Fatalf("Failed to apply migration %s: %v", f.Name(), err)
-			}
-			_, err = db.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, version)
-			if err != nil {
-				log.Fatalf("Failed to record migration version %d: %v", version, err)
-			}
-			fmt.Printf("Applied migration %s\n", f.Name())
-		}
-	}
-
-	return &DB{sql: db}
+	return db
 }
 
-func (db *DB) GetUsernameBySessionToken(token string) string {
-	var username string
-	err := db.sql.QueryRow("SELECT username FROM user WHERE session_token=?", token).Scan(&username)
-	if err == sql.ErrNoRows {
-		return ""
-	}
+// Open opens a database without touching its schema. dsns starting
+// with postgres:// or postgresql:// open a postgres database, anything
+// else is a path to a sqlite database. most callers want New, which
+// also applies migrations.
+func Open(dsn string) (*DB, error) {
+	driver, d := dialectFor(dsn)
+	db, err := sql.Open(driver, dsn)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	return username
+	return &DB{sql: &conn{DB: db, dialect: d}}, nil
 }
 
 func (db *DB) GetPassword(username string) string {
 	var password string
-	err := db.sql.QueryRow("SELECT password FROM user WHERE username=?", username).Scan(&password)
+	err := db.sql.QueryRow(`SELECT password FROM "user" WHERE username=?`, username).Scan(&password)
 	if err == sql.ErrNoRows {
 		return ""
 	}
@@ -105,50 +90,58 @@ func (db *DB) GetPassword(username string) string {
 	return password
 }
 
-func (db *DB) GetSessionToken(username string) (string, error) {
-	var result sql.NullString
-	err := db.sql.QueryRow("SELECT session_token FROM user WHERE username=?", username).Scan(&result)
-	if err == sql.ErrNoRows {
-		return "", nil
-	}
-	return result.String, err
-}
+// ErrUsernameTaken is returned when a new user's name matches an
+// existing one, ignoring case.
+var ErrUsernameTaken = errors.New("username is taken")
 
-func (db *DB) SetSessionToken(username string, token string) error {
-	_, err := db.sql.Exec("UPDATE user SET session_token=? WHERE username=?", token, username)
-	return err
+func (db *DB) AddUser(username string, passwordHash string) error {
+	return insertUser(db.sql, username, passwordHash)
 }
 
-func (db *DB) AddUser(username string, passwordHash string) error {
-	_, err := db.sql.Exec("INSERT INTO user (username, password) VALUES (?, ?)", username, passwordHash)
+// insertUser adds a user, turning the unique index on
+// username_lower into ErrUsernameTaken
+func insertUser(q querier, username string, passwordHash string) error {
+	_, err := q.Exec(`INSERT INTO "user" (username, username_lower, password) VALUES (?, lower(?), ?)`,
+		username, username, passwordHash)
+	if isUniqueViolation(err) {
+		return ErrUsernameTaken
+	}
 	return err
 }
 
-func (db *DB) subscribe(uid int, fid int) {
+// subscribe subscribes the user to the feed, doing nothing
+// if the subscription already exists.
+func subscribe(q querier, uid int, fid int) error {
 	var id int
-	err := db.sql.QueryRow("SELECT id FROM subscribe WHERE user_id=? AND feed_id=?", uid, fid).Scan(&id)
+	err := q.QueryRow("SELECT id FROM subscribe WHERE user_id=? AND feed_id=?", uid, fid).Scan(&id)
 	if err == sql.ErrNoRows {
-		_, err := db.sql.Exec("INSERT INTO subscribe (user_id, feed_id) VALUES (?, ?)", uid, fid)
-		if err != nil {
-			log.Fatal(err)
-		}
-		return
-	}
-	if err != nil {
-		log.Fatal(err)
+		_, err = q.Exec("INSERT INTO subscribe (user_id, feed_id) VALUES (?, ?)", uid, fid)
 	}
+	return err
+}
+
+func unsubscribeAll(q querier, uid int) error {
+	_, err := q.Exec("DELETE FROM subscribe WHERE user_id=?", uid)
+	return err
 }
 
-func (db *DB) unsubscribeAll(uid int) {
-	_, err := db.sql.Exec("DELETE FROM subscribe WHERE user_id=?", uid)
+func (db *DB) UserExists(username string) bool {
+	var result string
+	err := db.sql.QueryRow(`SELECT username FROM "user" WHERE username=?`, username).Scan(&result)
+	if err == sql.ErrNoRows {
+		return false
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
+	return true
 }
 
-func (db *DB) UserExists(username string) bool {
+// UsernameTaken reports whether a user exists whose
+// name matches username, ignoring case.
+func (db *DB) UsernameTaken(username string) bool {
 	var result string
-	err := db.sql.QueryRow("SELECT username FROM user WHERE username=?", username).Scan(&result)
+	err := db.sql.QueryRow(`SELECT username FROM "user" WHERE lower(username)=lower(?)`, username).Scan(&result)
 	if err == sql.ErrNoRows {
 		return false
 	}
@@ -158,6 +151,25 @@ func (db *DB) UserExists(username string) bool {
 	return true
 }
 
+func (db *DB) GetAllUsernames() []string {
+	rows, err := db.sql.Query(`SELECT username FROM "user" ORDER BY username`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+
+	var usernames []string
+	for rows.Next() {
+		var username string
+		err = rows.Scan(&username)
+		if err != nil {
+			log.Fatal(err)
+		}
+		usernames = append(usernames, username)
+	}
+	return usernames
+}
+
 func (db *DB) GetAllFeedURLs() []string {
 	// TODO: BAD SELECT STATEMENT!! SORRY :( --wesley
 	rows, err := db.sql.Query("SELECT url FROM feed")
@@ -187,7 +199,7 @@ func (db *DB) GetUserFeedURLs(username string) []string {
 		SELECT f.url
 		FROM feed f
 		JOIN subscribe s ON f.id = s.feed_id
-		JOIN user u ON s.user_id = u.id
+		JOIN "user" u ON s.user_id = u.id
 		WHERE u.id = ?`, uid)
 	if err == sql.ErrNoRows {
 		return []string{}
@@ -209,6 +221,33 @@ func (db *DB) GetUserFeedURLs(username string) []string {
 	return urls
 }
 
+// GetUserFeedIDs maps the url of every feed the user is
+// subscribed to to its id, in one query
+func (db *DB) GetUserFeedIDs(username string) map[string]int {
+	rows, err := db.sql.Query(`
+		SELECT f.url, f.id
+		FROM feed f
+		JOIN subscribe s ON f.id = s.feed_id
+		JOIN "user" u ON s.user_id = u.id
+		WHERE u.username = ?`, username)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+
+	ids := make(map[string]int)
+	for rows.Next() {
+		var url string
+		var id int
+		err = rows.Scan(&url, &id)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ids[url] = id
+	}
+	return ids
+}
+
 func (db *DB) GetUserSavedItems(username string) []SavedItem {
 	uid := db.GetUserID(username)
 
@@ -236,23 +275,33 @@ func (db *DB) GetUserSavedItems(username string) []SavedItem {
 }
 
 func (db *DB) GetUserID(username string) int {
-	var uid int
-	err := db.sql.QueryRow("SELECT id FROM user WHERE username=?", username).Scan(&uid)
+	uid, err := userID(db.sql, username)
 	if err != nil {
 		log.Fatal(err)
 	}
 	return uid
 }
 
+func userID(q querier, username string) (int, error) {
+	var uid int
+	err := q.QueryRow(`SELECT id FROM "user" WHERE username=?`, username).Scan(&uid)
+	return uid, err
+}
+
 func (db *DB) GetFeedID(feedURL string) int {
-	var fid int
-	err := db.sql.QueryRow("SELECT id FROM feed WHERE url=?", feedURL).Scan(&fid)
+	fid, err := feedID(db.sql, feedURL)
 	if err != nil {
 		log.Fatal(err)
 	}
 	return fid
 }
 
+func feedID(q querier, feedURL string) (int, error) {
+	var fid int
+	err := q.QueryRow("SELECT id FROM feed WHERE url=?", feedURL).Scan(&fid)
+	return fid, err
+}
+
 // WriteFeed writes an rss feed to the database for permanent storage
 // if the given feed already exists, WriteFeed does nothing.
 func (db *DB) WriteFeed(url string) {
@@ -273,6 +322,14 @@ func (db *DB) WriteSavedItem(username string, item SavedItem) error {
 	return err
 }
 
+// DeleteSavedItem removes every save of the item from the user's saves
+func (db *DB) DeleteSavedItem(username string, itemURL string) error {
+	_, err := db.sql.Exec(`
+		DELETE FROM saved_item
+		WHERE item_url=? AND user_id=(SELECT id FROM "user" WHERE username=?)`, itemURL, username)
+	return err
+}
+
 // WriteFeed writes an rss feed to the database for permanent storage
 // if the given feed already exists, WriteFeed does nothing.
 func (db *DB) SetFeedFetchError(url string, fetchErr string) error {
@@ -323,25 +380,81 @@ func (db *DB) GetFeedIDAndExists(feedURL string) (int, bool) {
 	return fid, true
 }
 
+// Subscribe adds a single feed to the user's subscriptions, leaving
+// the rest alone. the feed must already exist in the feed table. it
+// reports whether the user wasn't subscribed already.
+func (db *DB) Subscribe(username string, feedURL string) (bool, error) {
+	// one statement, so that two subscribes
+	// can't both decide the row is missing
+	res, err := db.sql.Exec(`
+		INSERT INTO subscribe (user_id, feed_id)
+		SELECT u.id, f.id FROM "user" u, feed f
+		WHERE u.username=? AND f.url=? AND NOT EXISTS (
+			SELECT 1 FROM subscribe s WHERE s.user_id=u.id AND s.feed_id=f.id
+		)`, username, feedURL)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if n > 0 {
+		return true, nil
+	}
+	if _, exists := db.GetFeedIDAndExists(feedURL); !exists {
+		return false, fmt.Errorf("can't find feed '%s'", feedURL)
+	}
+	return false, nil
+}
+
+// Unsubscribe drops a single feed from the user's subscriptions,
+// leaving the rest alone. it reports whether the user was subscribed.
+func (db *DB) Unsubscribe(username string, feedURL string) (bool, error) {
+	res, err := db.sql.Exec(`
+		DELETE FROM subscribe
+		WHERE user_id=(SELECT id FROM "user" WHERE username=?)
+		AND feed_id=(SELECT id FROM feed WHERE url=?)`, username, feedURL)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// BatchSubscribe replaces the user's subscriptions with the given
+// feed urls. every url must already exist in the feed table. the
+// replacement happens in a single transaction, so if any url fails
+// the user's existing subscriptions are left untouched.
 func (db *DB) BatchSubscribe(username string, feedURLs []string) error {
-	tx, err := db.sql.Begin()
+	tx, err := db.sql.begin()
 	if err != nil {
 		return err
 	}
+	// rollback is a no-op once the tx has been committed
+	defer tx.Rollback()
 
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-		}
-	}()
+	uid, err := userID(tx, username)
+	if err != nil {
+		return fmt.Errorf("can't find user '%s': %w", username, err)
+	}
 
 	// first, unsub from everything
-	uid := db.GetUserID(username)
-	db.unsubscribeAll(uid)
+	err = unsubscribeAll(tx, uid)
+	if err != nil {
+		return err
+	}
 
 	// Add new subscriptions
 	for _, url := range feedURLs {
-		db.subscribe(uid, db.GetFeedID(url))
+		fid, err := feedID(tx, url)
+		if err != nil {
+			return fmt.Errorf("can't find feed '%s': %w", url, err)
+		}
+		err = subscribe(tx, uid, fid)
+		if err != nil {
+			return fmt.Errorf("can't subscribe to '%s': %w", url, err)
+		}
 	}
 
 	return tx.Commit()
@@ -0,0 +1,215 @@
+package sqlite
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// seed creates a user subscribed to the given feeds
+func seed(t *testing.T, db *DB, username string, feeds ...string) {
+	t.Helper()
+	err := db.AddUser(username, "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range feeds {
+		db.WriteFeed(f)
+	}
+	err = db.BatchSubscribe(username, feeds)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func sortedFeedURLs(db *DB, username string) []string {
+	urls := db.GetUserFeedURLs(username)
+	sort.Strings(urls)
+	return urls
+}
+
+func TestBatchSubscribe(t *testing.T) {
+	testBackends(t, testBatchSubscribe)
+}
+
+func testBatchSubscribe(t *testing.T, db *DB) {
+	seed(t, db, "jes", "https://a.example/feed", "https://b.example/feed")
+	db.WriteFeed("https://c.example/feed")
+
+	err := db.BatchSubscribe("jes", []string{"https://b.example/feed", "https://c.example/feed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"https://b.example/feed", "https://c.example/feed"}
+	if got := sortedFeedURLs(db, "jes"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestBatchSubscribeRollsBackOnMissingFeed(t *testing.T) {
+	testBackends(t, testBatchSubscribeRollsBackOnMissingFeed)
+}
+
+func testBatchSubscribeRollsBackOnMissingFeed(t *testing.T, db *DB) {
+	seed(t, db, "jes", "https://a.example/feed", "https://b.example/feed")
+	db.WriteFeed("https://c.example/feed")
+
+	// the first url subscribes fine, the second one doesn't exist
+	err := db.BatchSubscribe("jes", []string{"https://c.example/feed", "https://nope.example/feed"})
+	if err == nil {
+		t.Fatal("expected an error subscribing to a missing feed")
+	}
+
+	want := []string{"https://a.example/feed", "https://b.example/feed"}
+	if got := sortedFeedURLs(db, "jes"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("subscriptions changed after failed batch: got %v, want %v", got, want)
+	}
+}
+
+// the injected failure uses a sqlite trigger, so this one is sqlite only
+func TestBatchSubscribeRollsBackOnInsertFailure(t *testing.T) {
+	db := NewMemory()
+	seed(t, db, "jes", "https://a.example/feed")
+	db.WriteFeed("https://b.example/feed")
+	db.WriteFeed("https://c.example/feed")
+
+	// make inserting the second subscription blow up
+	_, err := db.sql.Exec(`
+		CREATE TRIGGER fail_subscribe BEFORE INSERT ON subscribe
+		WHEN NEW.feed_id = (SELECT id FROM feed WHERE url = 'https://c.example/feed')
+		BEGIN SELECT RAISE(ABORT, 'injected failure'); END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.BatchSubscribe("jes", []string{"https://b.example/feed", "https://c.example/feed"})
+	if err == nil {
+		t.Fatal("expected injected failure")
+	}
+
+	want := []string{"https://a.example/feed"}
+	if got := sortedFeedURLs(db, "jes"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("subscriptions changed after failed batch: got %v, want %v", got, want)
+	}
+}
+
+func TestBatchSubscribeUnknownUser(t *testing.T) {
+	testBackends(t, testBatchSubscribeUnknownUser)
+}
+
+func testBatchSubscribeUnknownUser(t *testing.T, db *DB) {
+	db.WriteFeed("https://a.example/feed")
+
+	err := db.BatchSubscribe("nobody", []string{"https://a.example/feed"})
+	if err == nil {
+		t.Fatal("expected an error for a user that doesn't exist")
+	}
+}
+
+func TestAddUserIgnoresCase(t *testing.T) {
+	testBackends(t, testAddUserIgnoresCase)
+}
+
+func testAddUserIgnoresCase(t *testing.T, db *DB) {
+	seed(t, db, "jes")
+	err := db.AddUser("JES", "hunter2")
+	if !errors.Is(err, ErrUsernameTaken) {
+		t.Fatalf("got %v, want ErrUsernameTaken", err)
+	}
+	err = db.AddUser("jes", "hunter2")
+	if !errors.Is(err, ErrUsernameTaken) {
+		t.Fatalf("got %v, want ErrUsernameTaken", err)
+	}
+}
+
+func TestUniqueUsernamesWithExistingClashes(t *testing.T) {
+	testEmptyBackends(t, testUniqueUsernamesWithExistingClashes)
+}
+
+func testUniqueUsernamesWithExistingClashes(t *testing.T, db *DB) {
+	migrations := mustEmbeddedMigrations(t, db)
+	// a database from before the unique index, with users
+	// that only differ by case
+	var before []Migration
+	for _, m := range migrations {
+		if m.Version < 12 {
+			before = append(before, m)
+		}
+	}
+	err := db.migrate(before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, username := range []string{"jes", "JES"} {
+		_, err = db.sql.Exec(`INSERT INTO "user" (username, password) VALUES (?, ?)`, username, "hunter2")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = db.migrate(migrations)
+	if err != nil {
+		t.Fatalf("migrating with clashing users: %s", err)
+	}
+	seed(t, db, "wesley")
+	err = db.AddUser("Wesley", "hunter2")
+	if !errors.Is(err, ErrUsernameTaken) {
+		t.Fatalf("got %v, want ErrUsernameTaken", err)
+	}
+}
+
+func TestSubscribeAndUnsubscribe(t *testing.T) {
+	testBackends(t, testSubscribeAndUnsubscribe)
+}
+
+func testSubscribeAndUnsubscribe(t *testing.T, db *DB) {
+	seed(t, db, "jes", "https://a.example/feed")
+	db.WriteFeed("https://b.example/feed")
+
+	added, err := db.Subscribe("jes", "https://b.example/feed")
+	if err != nil || !added {
+		t.Fatalf("subscribe: got %v, %v", added, err)
+	}
+	added, err = db.Subscribe("jes", "https://b.example/feed")
+	if err != nil || added {
+		t.Fatalf("subscribing twice: got %v, %v", added, err)
+	}
+	if _, err := db.Subscribe("jes", "https://nowhere.example/feed"); err == nil {
+		t.Fatal("subscribing to an unknown feed should be an error")
+	}
+	want := []string{"https://a.example/feed", "https://b.example/feed"}
+	if got := sortedFeedURLs(db, "jes"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	removed, err := db.Unsubscribe("jes", "https://a.example/feed")
+	if err != nil || !removed {
+		t.Fatalf("unsubscribe: got %v, %v", removed, err)
+	}
+	removed, err = db.Unsubscribe("jes", "https://a.example/feed")
+	if err != nil || removed {
+		t.Fatalf("unsubscribing twice: got %v, %v", removed, err)
+	}
+	want = []string{"https://b.example/feed"}
+	if got := sortedFeedURLs(db, "jes"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestGetUserFeedIDs(t *testing.T) {
+	testBackends(t, testGetUserFeedIDs)
+}
+
+func testGetUserFeedIDs(t *testing.T, db *DB) {
+	seed(t, db, "jes", "https://a.example/feed", "https://b.example/feed")
+	seed(t, db, "wesley", "https://c.example/feed")
+	want := map[string]int{
+		"https://a.example/feed": db.GetFeedID("https://a.example/feed"),
+		"https://b.example/feed": db.GetFeedID("https://b.example/feed"),
+	}
+	if got := db.GetUserFeedIDs("jes"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,87 @@
+package sqlite
+
+import "time"
+
+// Store is everything vore needs from its database. the web
+// handlers and the reaper depend on a Store rather than on *DB
+// directly, which lets tests hand them a throwaway database
+// (see NewMemory).
+type Store interface {
+	// users
+	AddUser(username string, passwordHash string) error
+	SetPassword(username string, passwordHash string) error
+	DeleteUser(username string) (orphanedFeeds []string, err error)
+	UserExists(username string) bool
+	UsernameTaken(username string) bool
+	GetAllUsernames() []string
+	GetPassword(username string) string
+	IsAdmin(username string) bool
+	SetAdmin(username string, admin bool) error
+	UserDisabled(username string) bool
+	SetDisabled(username string, disabled bool) error
+	GetUsers() []User
+
+	// invites
+	CreateInvite(createdBy string, code string, maxUses int, expiresAt time.Time) error
+	GetInvites() []Invite
+	ExpireInvite(id int) error
+	AddUserWithInvite(username string, passwordHash string, code string) error
+
+	// two-factor auth
+	GetTOTPSecret(username string) string
+	EnableTOTP(username string, secret string, recoveryCodeHashes []string) error
+	DisableTOTP(username string) error
+	UseTOTPStep(username string, step int64) bool
+	UseRecoveryCode(username string, codeHash string) bool
+	RecoveryCodesLeft(username string) int
+
+	// sessions
+	CreateSession(username string, tokenHash string, userAgent string, expiresAt time.Time) error
+	GetSession(tokenHash string) (Session, bool)
+	TouchSession(id int) error
+	GetUserSessions(username string) []Session
+	DeleteSession(tokenHash string) error
+	DeleteUserSession(username string, id int) error
+	DeleteOtherUserSessions(username string, keepID int) error
+	DeleteExpiredSessions() error
+
+	// api tokens
+	CreateAPIToken(username string, name string, tokenHash string, feverKeyHash string, scope string) error
+	GetAPIToken(tokenHash string) (APIToken, bool)
+	GetAPITokenByFeverKey(feverKeyHash string) (APIToken, bool)
+	LinkGeminiCertificate(tokenID int, fingerprint string) error
+	GetGeminiCertificateToken(fingerprint string) (APIToken, bool)
+	TouchAPIToken(id int) error
+	GetUserAPITokens(username string) []APIToken
+	DeleteUserAPIToken(username string, id int) error
+
+	// feeds
+	WriteFeed(url string)
+	GetAllFeedURLs() []string
+	GetFeedIDAndExists(feedURL string) (int, bool)
+	GetFeedFetchError(url string) (string, error)
+	SetFeedFetchError(url string, fetchErr string) error
+	GetSubscriberCount(feedURL string) int
+	GetFeeds() []FeedInfo
+	DeleteFeed(feedURL string) error
+
+	// subscriptions
+	GetUserFeedURLs(username string) []string
+	GetUserFeedIDs(username string) map[string]int
+	BatchSubscribe(username string, feedURLs []string) error
+	Subscribe(username string, feedURL string) (bool, error)
+	Unsubscribe(username string, feedURL string) (bool, error)
+
+	// saves
+	GetUserSavedItems(username string) []SavedItem
+	WriteSavedItem(username string, item SavedItem) error
+	DeleteSavedItem(username string, itemURL string) error
+	GetRecentSavedItems(limit int) []SavedItem
+
+	// fever
+	NumberItems(guids []string) (map[string]int64, error)
+	GetReadItems(username string) map[int64]bool
+	SetItemsRead(username string, ids []int64, read bool) error
+}
+
+var _ Store = (*DB)(nil)
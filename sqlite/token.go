@@ -0,0 +1,123 @@
+package sqlite
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// APIToken is a personal token a user has made for scripting
+// against vore. like sessions, tokens are looked up by their hash.
+type APIToken struct {
+	ID        int
+	Username  string
+	Name      string
+	Scope     string
+	CreatedAt time.Time
+	// LastUsedAt is zero if the token has never been used
+	LastUsedAt time.Time
+}
+
+// CreateAPIToken records a new api token for the user. feverKeyHash
+// is the hash of the key fever clients send when the token is
+// used as a password.
+func (db *DB) CreateAPIToken(username string, name string, tokenHash string, feverKeyHash string, scope string) error {
+	_, err := db.sql.Exec(`
+		INSERT INTO api_token (user_id, name, token_hash, fever_key_hash, scope, created_at)
+		SELECT id, ?, ?, ?, ?, ? FROM "user" WHERE username=?`,
+		name, tokenHash, feverKeyHash, scope, time.Now().UTC(), username)
+	return err
+}
+
+// GetAPIToken looks up a token by its hash. tokens belonging
+// to disabled users don't work.
+func (db *DB) GetAPIToken(tokenHash string) (APIToken, bool) {
+	return db.getAPIToken("token_hash", tokenHash)
+}
+
+// GetAPITokenByFeverKey is GetAPIToken for fever clients, which
+// send md5(username:token) rather than the token itself.
+func (db *DB) GetAPITokenByFeverKey(feverKeyHash string) (APIToken, bool) {
+	return db.getAPIToken("fever_key_hash", feverKeyHash)
+}
+
+// column is never user input
+func (db *DB) getAPIToken(column string, hash string) (APIToken, bool) {
+	rows, err := db.sql.Query(`
+		SELECT t.id, u.username, t.name, t.scope, t.created_at, t.last_used_at
+		FROM api_token t
+		JOIN "user" u ON t.user_id = u.id
+		WHERE t.`+column+`=? AND NOT u.disabled`, hash)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tokens := scanAPITokens(rows)
+	if len(tokens) == 0 {
+		return APIToken{}, false
+	}
+	return tokens[0], true
+}
+
+// TouchAPIToken bumps the token's last used time to now.
+func (db *DB) TouchAPIToken(id int) error {
+	_, err := db.sql.Exec("UPDATE api_token SET last_used_at=? WHERE id=?", time.Now().UTC(), id)
+	return err
+}
+
+// GetUserAPITokens returns every one of the user's tokens, newest first.
+func (db *DB) GetUserAPITokens(username string) []APIToken {
+	rows, err := db.sql.Query(`
+		SELECT t.id, u.username, t.name, t.scope, t.created_at, t.last_used_at
+		FROM api_token t
+		JOIN "user" u ON t.user_id = u.id
+		WHERE u.username=?
+		ORDER BY t.created_at DESC, t.id DESC`, username)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return scanAPITokens(rows)
+}
+
+// DeleteUserAPIToken revokes one of the user's tokens by id. tokens
+// belonging to other users are left alone.
+func (db *DB) DeleteUserAPIToken(username string, id int) error {
+	tx, err := db.sql.begin()
+	if err != nil {
+		return err
+	}
+	// rollback is a no-op once the tx has been committed
+	defer tx.Rollback()
+
+	uid, err := userID(tx, username)
+	if err != nil {
+		return err
+	}
+	// certificates linked with the token go with it
+	_, err = tx.Exec(`
+		DELETE FROM gemini_certificate
+		WHERE token_id=(SELECT id FROM api_token WHERE id=? AND user_id=?)`, id, uid)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM api_token WHERE id=? AND user_id=?", id, uid)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func scanAPITokens(rows *sql.Rows) []APIToken {
+	defer rows.Close()
+	var tokens []APIToken
+	for rows.Next() {
+		var t APIToken
+		var lastUsed sql.NullTime
+		err := rows.Scan(&t.ID, &t.Username, &t.Name, &t.Scope, &t.CreatedAt, &lastUsed)
+		if err != nil {
+			log.Fatal(err)
+		}
+		t.LastUsedAt = lastUsed.Time
+		tokens = append(tokens, t)
+	}
+	return tokens
+}
@@ -0,0 +1,58 @@
+package sqlite
+
+import "testing"
+
+func TestAPITokens(t *testing.T) {
+	testBackends(t, testAPITokens)
+}
+
+func testAPITokens(t *testing.T, db *DB) {
+	seed(t, db, "jes")
+	seed(t, db, "wesley")
+	if err := db.CreateAPIToken("jes", "notes", "hash-notes", "fever-notes", "read"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateAPIToken("wesley", "bulk", "hash-bulk", "fever-bulk", "write"); err != nil {
+		t.Fatal(err)
+	}
+
+	token, ok := db.GetAPIToken("hash-notes")
+	if !ok || token.Username != "jes" || token.Name != "notes" || token.Scope != "read" {
+		t.Fatalf("got token %+v", token)
+	}
+	if byKey, ok := db.GetAPITokenByFeverKey("fever-notes"); !ok || byKey.ID != token.ID {
+		t.Fatalf("fever key should find the same token, got %+v", byKey)
+	}
+	if !token.LastUsedAt.IsZero() {
+		t.Fatal("new token should never have been used")
+	}
+	if err := db.TouchAPIToken(token.ID); err != nil {
+		t.Fatal(err)
+	}
+	if token, _ := db.GetAPIToken("hash-notes"); token.LastUsedAt.IsZero() {
+		t.Fatal("touched token should have a last used time")
+	}
+
+	// jes can't revoke wesley's token by guessing its id
+	bulk, _ := db.GetAPIToken("hash-bulk")
+	if err := db.DeleteUserAPIToken("jes", bulk.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := db.GetAPIToken("hash-bulk"); !ok {
+		t.Fatal("jes should not be able to revoke wesley's token")
+	}
+
+	if err := db.SetDisabled("wesley", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := db.GetAPIToken("hash-bulk"); ok {
+		t.Fatal("disabled users' tokens should not work")
+	}
+
+	if err := db.DeleteUserAPIToken("jes", token.ID); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.GetUserAPITokens("jes")) != 0 {
+		t.Fatal("revoked token should be gone")
+	}
+}
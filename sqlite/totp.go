@@ -0,0 +1,122 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// GetTOTPSecret returns the user's totp secret, or
+// "" if they haven't turned on two-factor auth.
+func (db *DB) GetTOTPSecret(username string) string {
+	var secret sql.NullString
+	err := db.sql.QueryRow(`SELECT totp_secret FROM "user" WHERE username=?`, username).Scan(&secret)
+	if err == sql.ErrNoRows {
+		return ""
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	return secret.String
+}
+
+// EnableTOTP turns on two-factor auth for the user, replacing any
+// recovery codes they had with the given hashes.
+func (db *DB) EnableTOTP(username string, secret string, recoveryCodeHashes []string) error {
+	tx, err := db.sql.begin()
+	if err != nil {
+		return err
+	}
+	// rollback is a no-op once the tx has been committed
+	defer tx.Rollback()
+
+	uid, err := userID(tx, username)
+	if err != nil {
+		return fmt.Errorf("can't find user '%s': %w", username, err)
+	}
+	_, err = tx.Exec(`UPDATE "user" SET totp_secret=?, totp_last_step=0 WHERE id=?`, secret, uid)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM recovery_code WHERE user_id=?", uid)
+	if err != nil {
+		return err
+	}
+	for _, hash := range recoveryCodeHashes {
+		_, err = tx.Exec("INSERT INTO recovery_code (user_id, code_hash) VALUES (?, ?)", uid, hash)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DisableTOTP turns off two-factor auth for the
+// user and throws away their recovery codes.
+func (db *DB) DisableTOTP(username string) error {
+	tx, err := db.sql.begin()
+	if err != nil {
+		return err
+	}
+	// rollback is a no-op once the tx has been committed
+	defer tx.Rollback()
+
+	uid, err := userID(tx, username)
+	if err != nil {
+		return fmt.Errorf("can't find user '%s': %w", username, err)
+	}
+	_, err = tx.Exec(`UPDATE "user" SET totp_secret=NULL, totp_last_step=0 WHERE id=?`, uid)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM recovery_code WHERE user_id=?", uid)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UseTOTPStep records that the user has used the code for the given
+// time step. it returns false if that step, or a later one, has
+// already been used, so every code only works once.
+func (db *DB) UseTOTPStep(username string, step int64) bool {
+	res, err := db.sql.Exec(`
+		UPDATE "user" SET totp_last_step=?
+		WHERE username=? AND totp_last_step < ?`, step, username, step)
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	n, err := res.RowsAffected()
+	return err == nil && n > 0
+}
+
+// UseRecoveryCode burns one of the user's unused recovery codes.
+// it returns false if there's no such unused code.
+func (db *DB) UseRecoveryCode(username string, codeHash string) bool {
+	res, err := db.sql.Exec(`
+		UPDATE recovery_code SET used_at=?
+		WHERE code_hash=? AND used_at IS NULL
+		AND user_id=(SELECT id FROM "user" WHERE username=?)`,
+		time.Now().UTC(), codeHash, username)
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	n, err := res.RowsAffected()
+	return err == nil && n > 0
+}
+
+// RecoveryCodesLeft counts the user's unused recovery codes.
+func (db *DB) RecoveryCodesLeft(username string) int {
+	var n int
+	err := db.sql.QueryRow(`
+		SELECT COUNT(*) FROM recovery_code
+		WHERE used_at IS NULL
+		AND user_id=(SELECT id FROM "user" WHERE username=?)`, username).Scan(&n)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return n
+}
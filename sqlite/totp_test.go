@@ -0,0 +1,46 @@
+package sqlite
+
+import "testing"
+
+func TestTOTP(t *testing.T) {
+	testBackends(t, testTOTP)
+}
+
+func testTOTP(t *testing.T, db *DB) {
+	seed(t, db, "jes")
+	if db.GetTOTPSecret("jes") != "" {
+		t.Fatal("two-factor auth should be off by default")
+	}
+
+	err := db.EnableTOTP("jes", "SECRET", []string{"hash-a", "hash-b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := db.GetTOTPSecret("jes"); got != "SECRET" {
+		t.Fatalf("got secret %q", got)
+	}
+
+	if !db.UseTOTPStep("jes", 100) {
+		t.Fatal("first use of a step should work")
+	}
+	if db.UseTOTPStep("jes", 100) || db.UseTOTPStep("jes", 99) {
+		t.Fatal("old steps should not work again")
+	}
+
+	if !db.UseRecoveryCode("jes", "hash-a") {
+		t.Fatal("unused recovery code should work")
+	}
+	if db.UseRecoveryCode("jes", "hash-a") || db.UseRecoveryCode("jes", "hash-c") {
+		t.Fatal("used or unknown recovery codes should not work")
+	}
+	if got := db.RecoveryCodesLeft("jes"); got != 1 {
+		t.Fatalf("got %d recovery codes left, want 1", got)
+	}
+
+	if err := db.DisableTOTP("jes"); err != nil {
+		t.Fatal(err)
+	}
+	if db.GetTOTPSecret("jes") != "" || db.RecoveryCodesLeft("jes") != 0 {
+		t.Fatal("disabling should clear the secret and recovery codes")
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// benchFeeds & benchItems make a user who follows a lot
+const (
+	benchFeeds = 500
+	benchItems = 20
+)
+
+// BenchmarkHomepage is a request for the homepage of somebody
+// following benchFeeds feeds, with and without their timeline
+// in the reaper's cache.
+func BenchmarkHomepage(b *testing.B) {
+	newest := time.Now().Add(-time.Hour)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// feeds with longer paths are a few minutes behind,
+		// so that items from different feeds interleave
+		var items strings.Builder
+		for i := range benchItems {
+			fmt.Fprintf(&items, `<item><title>post %d</title><link>https://blog.example%s/%d</link><pubDate>%s</pubDate></item>`,
+				i, r.URL.Path, i, newest.Add(-time.Duration(i)*time.Hour-time.Duration(len(r.URL.Path))*time.Minute).Format(time.RFC1123))
+		}
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprintf(w, `<rss version="2.0"><channel><title>%s</title>%s</channel></rss>`, r.URL.Path, items.String())
+	}))
+	b.Cleanup(srv.Close)
+
+	s, h := newTestSite(b)
+	err := s.db.AddUser("jes", "hunter2")
+	if err != nil {
+		b.Fatal(err)
+	}
+	var urls []string
+	for i := range benchFeeds {
+		urls = append(urls, fmt.Sprintf("%s/feed/%d", srv.URL, i))
+	}
+	err = s.setSubscriptions("jes", urls)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, bc := range []struct {
+		name   string
+		cached bool
+	}{
+		{"cached", true},
+		{"uncached", false},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			for range b.N {
+				if !bc.cached {
+					s.reaper.InvalidateUser("jes")
+				}
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, httptest.NewRequest("GET", "/jes", nil))
+				if w.Code != http.StatusOK {
+					b.Fatalf("got status %d", w.Code)
+				}
+			}
+		})
+	}
+}
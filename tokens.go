@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"git.j3s.sh/vore/lib"
+	"git.j3s.sh/vore/sqlite"
+)
+
+const (
+	// scopeRead tokens can only look at things
+	scopeRead = "read"
+	// scopeWrite tokens can change things too
+	scopeWrite = "write"
+
+	// apiTokenPrefix makes leaked tokens easy to grep for
+	apiTokenPrefix    = "vore_"
+	maxTokenNameRunes = 64
+)
+
+// bearerToken returns the token from r's Authorization header, and
+// whether there was a bearer token at all. other schemes don't count:
+// browsers send basic auth credentials on their own.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// apiUser works out who is making an api request. requests with a
+// bearer token are judged on their token alone, everybody
+// else on their session cookie. sessions can do anything, tokens
+// only what their scope allows. apiUser writes the error response
+// itself if the request isn't allowed.
+func (s *Site) apiUser(w http.ResponseWriter, r *http.Request, scope string) (string, bool) {
+	token, ok := bearerToken(r)
+	if !ok {
+		username := s.username(r)
+		if username == "" {
+			s.apiErr(w, "log in or send an api token", http.StatusUnauthorized)
+			return "", false
+		}
+		return username, true
+	}
+
+	t, ok := s.db.GetAPIToken(lib.HashToken(token))
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="vore"`)
+		s.apiErr(w, "invalid api token", http.StatusUnauthorized)
+		return "", false
+	}
+	if scope == scopeWrite && t.Scope != scopeWrite {
+		s.apiErr(w, "this api token is read-only", http.StatusForbidden)
+		return "", false
+	}
+	err := s.touchAPIToken(t)
+	if err != nil {
+		s.apiErr(w, err.Error(), http.StatusInternalServerError)
+		return "", false
+	}
+	return t.Username, true
+}
+
+// touchAPIToken records that the token was just used
+func (s *Site) touchAPIToken(t sqlite.APIToken) error {
+	// don't write to the db on every single request
+	if time.Since(t.LastUsedAt) > time.Minute {
+		return s.db.TouchAPIToken(t.ID)
+	}
+	return nil
+}
+
+// tokenCreateHandler mints a new api token and shows it to the
+// user, once. only its hash is kept.
+func (s *Site) tokenCreateHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr(w, "", http.StatusUnauthorized)
+		return
+	}
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" || utf8.RuneCountInString(name) > maxTokenNameRunes {
+		e := fmt.Sprintf("token name must be 1 to %d characters", maxTokenNameRunes)
+		s.renderErr(w, e, http.StatusBadRequest)
+		return
+	}
+	scope := r.FormValue("scope")
+	if scope != scopeRead && scope != scopeWrite {
+		e := fmt.Sprintf("unknown scope '%s', want %s or %s", scope, scopeRead, scopeWrite)
+		s.renderErr(w, e, http.StatusBadRequest)
+		return
+	}
+
+	secret := lib.GenerateSecureToken(32)
+	if secret == "" {
+		s.renderErr(w, "could not generate a token", http.StatusInternalServerError)
+		return
+	}
+	token := apiTokenPrefix + secret
+	username := s.username(r)
+	err := s.db.CreateAPIToken(username, name, lib.HashToken(token), lib.HashToken(feverKey(username, token)), scope)
+	if err != nil {
+		s.renderErr(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Name  string
+		Scope string
+		Token string
+	}{
+		Name:  name,
+		Scope: scope,
+		Token: token,
+	}
+	s.renderPage(w, r, "apiToken", data)
+}
+
+// tokenRevokeHandler deletes one of the user's api tokens
+func (s *Site) tokenRevokeHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr(w, "", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		e := fmt.Sprintf("invalid token id '%s'", r.FormValue("id"))
+		s.renderErr(w, e, http.StatusBadRequest)
+		return
+	}
+	err = s.db.DeleteUserAPIToken(s.username(r), id)
+	if err != nil {
+		s.renderErr(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var apiTokenRe = regexp.MustCompile(`vore_[0-9a-f]{64}`)
+
+// newAPIToken mints a token through the settings page
+func newAPIToken(t *testing.T, h http.Handler, session *http.Cookie, scope string) string {
+	t.Helper()
+	w := do(h, "POST", "/settings/tokens/create", url.Values{"name": {"script"}, "scope": {scope}}, session)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create token: got status %d: %s", w.Code, w.Body)
+	}
+	token := apiTokenRe.FindString(w.Body.String())
+	if token == "" {
+		t.Fatal("token page should show the token")
+	}
+	return token
+}
+
+// apiDo sends an api request with the given bearer token and json body
+func apiDo(h http.Handler, method string, target string, token string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestAPITokenScopes(t *testing.T) {
+	s, h := newTestSite(t)
+	feed := newFeedServer(t)
+	session := register(t, h, "jes", "correct horse")
+	read := newAPIToken(t, h, session, scopeRead)
+	write := newAPIToken(t, h, session, scopeWrite)
+
+	body := `{"urls": ["` + feed.URL + `"]}`
+	w := apiDo(h, "PUT", "/api/v1/subscriptions", read, body)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("read token writing: got status %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	// no csrf token needed with a bearer token
+	w = apiDo(h, "PUT", "/api/v1/subscriptions", write, body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("write token: got status %d: %s", w.Code, w.Body)
+	}
+
+	w = apiDo(h, "GET", "/api/v1/subscriptions", read, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("read token reading: got status %d: %s", w.Code, w.Body)
+	}
+	var feeds []apiFeed
+	if err := json.Unmarshal(w.Body.Bytes(), &feeds); err != nil {
+		t.Fatal(err)
+	}
+	if len(feeds) != 1 || feeds[0].URL != feed.URL || feeds[0].Title != "test feed" {
+		t.Fatalf("got feeds %+v", feeds)
+	}
+
+	for _, tok := range s.db.GetUserAPITokens("jes") {
+		if tok.LastUsedAt.IsZero() {
+			t.Errorf("token %d should have a last used time", tok.ID)
+		}
+	}
+}
+
+func TestAPITokenRejected(t *testing.T) {
+	s, h := newTestSite(t)
+	session := register(t, h, "jes", "correct horse")
+	token := newAPIToken(t, h, session, scopeRead)
+
+	w := apiDo(h, "GET", "/api/v1/saves", "vore_nope", "")
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+		t.Fatalf("bad token: got status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if !strings.Contains(w.Body.String(), `"error"`) {
+		t.Fatalf("api errors should be json, got %s", w.Body)
+	}
+	if w := apiDo(h, "GET", "/api/v1/saves", "", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("no token: got status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	id := s.db.GetUserAPITokens("jes")[0].ID
+	do(h, "POST", "/settings/tokens/revoke", url.Values{"id": {strconv.Itoa(id)}}, session)
+	if w := apiDo(h, "GET", "/api/v1/saves", token, ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("revoked token: got status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestAPISessionAuth(t *testing.T) {
+	_, h := newTestSite(t)
+	session := register(t, h, "jes", "correct horse")
+
+	w := do(h, "GET", "/api/v1/saves", nil, session)
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+
+	// cookie-authed writes still need a csrf token
+	req := httptest.NewRequest("PUT", "/api/v1/subscriptions", strings.NewReader(`{"urls": []}`))
+	req.AddCookie(session)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("cookie write without csrf: got status %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
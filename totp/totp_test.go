@@ -0,0 +1,77 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the sha1 test vectors from RFC 6238 appendix B. the rfc uses
+// eight digit codes, ours are the last six digits of those.
+func TestCodeRFC6238Vectors(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	vectors := map[int64]string{
+		59:          "94287082",
+		1111111109:  "07081804",
+		1111111111:  "14050471",
+		1234567890:  "89005924",
+		2000000000:  "69279037",
+		20000000000: "65353130",
+	}
+	for unix, want := range vectors {
+		got, err := Code(secret, Step(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want[2:] {
+			t.Errorf("at %d: got %s, want %s", unix, got, want[2:])
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1234567890, 0)
+	code, err := Code(secret, Step(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	step, ok := Validate(secret, code, now)
+	if !ok || step != Step(now) {
+		t.Fatalf("code should be valid now, got step %d ok %v", step, ok)
+	}
+	if _, ok := Validate(secret, code[:3]+" "+code[3:], now); !ok {
+		t.Fatal("spaces should be ignored")
+	}
+	if _, ok := Validate(secret, code, now.Add(Period)); !ok {
+		t.Fatal("code should be valid one period later")
+	}
+	if _, ok := Validate(secret, code, now.Add(3*Period)); ok {
+		t.Fatal("code should have expired three periods later")
+	}
+	if _, ok := Validate(secret, "005925", now); ok {
+		t.Fatal("wrong code should be invalid")
+	}
+	if _, ok := Validate(secret, "12345", now); ok {
+		t.Fatal("short code should be invalid")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Code(secret, 0); err != nil {
+		t.Fatalf("generated secret should be usable: %s", err)
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("vore", "jes", "ABC")
+	if !strings.HasPrefix(uri, "otpauth://totp/vore:jes?") || !strings.Contains(uri, "secret=ABC") {
+		t.Fatalf("got uri %s", uri)
+	}
+}
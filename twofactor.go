@@ -0,0 +1,257 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"git.j3s.sh/vore/lib"
+	"git.j3s.sh/vore/totp"
+)
+
+const (
+	// challengeCookie holds the token for a login that has passed
+	// the password check and is waiting on a two-factor code
+	challengeCookie = "login_challenge"
+	// how long somebody has to type in their code
+	challengeLifetime = 5 * time.Minute
+	// how many recovery codes a user gets at a time
+	recoveryCodeCount = 10
+)
+
+// challenges are logins that are half done. they only live in
+// memory, the worst a restart does is make somebody log in again.
+type challenges struct {
+	lifetime time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	pending map[string]challenge
+}
+
+type challenge struct {
+	username string
+	expires  time.Time
+}
+
+func newChallenges(lifetime time.Duration) *challenges {
+	return &challenges{
+		lifetime: lifetime,
+		now:      time.Now,
+		pending:  make(map[string]challenge),
+	}
+}
+
+// start records a half done login for username and
+// returns the token that identifies it
+func (c *challenges) start(username string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	// piggyback some housekeeping on new challenges
+	for token, ch := range c.pending {
+		if !now.Before(ch.expires) {
+			delete(c.pending, token)
+		}
+	}
+	token := lib.GenerateSecureToken(32)
+	c.pending[lib.HashToken(token)] = challenge{
+		username: username,
+		expires:  now.Add(c.lifetime),
+	}
+	return token
+}
+
+// username returns who the challenge token belongs to,
+// or false if the challenge is unknown or has expired
+func (c *challenges) username(token string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch, ok := c.pending[lib.HashToken(token)]
+	if !ok || !c.now().Before(ch.expires) {
+		return "", false
+	}
+	return ch.username, true
+}
+
+// finish forgets about the challenge
+func (c *challenges) finish(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, lib.HashToken(token))
+}
+
+// challengeUsername returns who the client's pending login belongs to
+func (s *Site) challengeUsername(r *http.Request) (string, string, bool) {
+	cookie, err := r.Cookie(challengeCookie)
+	if err != nil {
+		return "", "", false
+	}
+	username, ok := s.challenges.username(cookie.Value)
+	return cookie.Value, username, ok
+}
+
+// startChallenge sends a client whose password checked out
+// on to the second step of logging in
+func (s *Site) startChallenge(w http.ResponseWriter, r *http.Request, username string) {
+	s.setCookie(w, &http.Cookie{
+		Name:   challengeCookie,
+		Value:  s.challenges.start(username),
+		MaxAge: int(challengeLifetime.Seconds()),
+	})
+	http.Redirect(w, r, "/login/2fa", http.StatusSeeOther)
+}
+
+// twoFactorHandler is the second step of logging in
+// for users who have two-factor auth turned on
+func (s *Site) twoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	token, username, ok := s.challengeUsername(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if r.Method == "GET" {
+		s.renderPage(w, r, "twoFactor", nil)
+		return
+	}
+
+	// wrong codes count against the same limit as wrong passwords
+	accountKey := strings.ToLower(username)
+	if wait, locked := s.limiters.loginAccount.locked(accountKey); locked {
+		s.tooManyAttempts(w, wait)
+		return
+	}
+	if !s.checkSecondFactor(username, r.FormValue("code")) {
+		s.limiters.loginAccount.fail(accountKey)
+		s.renderErr(w, "invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	s.challenges.finish(token)
+	s.setCookie(w, &http.Cookie{
+		Name:   challengeCookie,
+		Value:  "",
+		MaxAge: -1,
+	})
+	err := s.startSession(w, r, username)
+	if err != nil {
+		s.renderErr(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.limiters.loginAccount.reset(accountKey)
+	http.Redirect(w, r, "/"+username, http.StatusSeeOther)
+}
+
+// checkSecondFactor accepts either a current totp code or one of the
+// user's recovery codes. either can only be used once.
+func (s *Site) checkSecondFactor(username string, code string) bool {
+	secret := s.db.GetTOTPSecret(username)
+	if secret == "" {
+		return false
+	}
+	if step, ok := totp.Validate(secret, code, s.now()); ok {
+		return s.db.UseTOTPStep(username, step)
+	}
+	return s.db.UseRecoveryCode(username, lib.HashToken(normalizeRecoveryCode(code)))
+}
+
+// twoFactorSetupHandler shows a fresh secret for the user
+// to add to their authenticator app
+func (s *Site) twoFactorSetupHandler(w http.ResponseWriter, r *http.Request) {
+	session, ok := s.session(r)
+	if !ok {
+		s.renderErr(w, "", http.StatusUnauthorized)
+		return
+	}
+	if s.db.GetTOTPSecret(session.Username) != "" {
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		s.renderErr(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data := struct {
+		Secret string
+		// otpauth: links would be filtered out as unsafe otherwise
+		URI template.URL
+	}{
+		Secret: secret,
+		URI:    template.URL(totp.URI(s.title, session.Username, secret)),
+	}
+	s.renderPage(w, r, "twoFactorSetup", data)
+}
+
+// twoFactorEnableHandler turns on two-factor auth once the user has
+// proven that their authenticator app produces the right codes. the
+// secret round trips through the setup form, so nothing is stored
+// until then.
+func (s *Site) twoFactorEnableHandler(w http.ResponseWriter, r *http.Request) {
+	session, ok := s.session(r)
+	if !ok {
+		s.renderErr(w, "", http.StatusUnauthorized)
+		return
+	}
+	// swapping in a new secret goes through disabling first,
+	// which asks for the password
+	if s.db.GetTOTPSecret(session.Username) != "" {
+		s.renderErr(w, "two-factor auth is already on", http.StatusBadRequest)
+		return
+	}
+
+	secret := r.FormValue("secret")
+	step, ok := totp.Validate(secret, r.FormValue("code"), s.now())
+	if !ok {
+		s.renderErr(w, "that code didn't match, go back and try again", http.StatusBadRequest)
+		return
+	}
+
+	var codes, hashes []string
+	for range recoveryCodeCount {
+		code := lib.GenerateSecureToken(5)
+		if code == "" {
+			s.renderErr(w, "could not generate recovery codes", http.StatusInternalServerError)
+			return
+		}
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, lib.HashToken(code))
+	}
+	err := s.db.EnableTOTP(session.Username, secret, hashes)
+	if err != nil {
+		s.renderErr(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// the code that was just typed in is spent
+	s.db.UseTOTPStep(session.Username, step)
+
+	s.renderPage(w, r, "twoFactorRecovery", codes)
+}
+
+// twoFactorDisableHandler turns two-factor auth back off
+func (s *Site) twoFactorDisableHandler(w http.ResponseWriter, r *http.Request) {
+	session, ok := s.session(r)
+	if !ok {
+		s.renderErr(w, "", http.StatusUnauthorized)
+		return
+	}
+	if !s.checkPassword(w, session, r.FormValue("password")) {
+		return
+	}
+	err := s.db.DisableTOTP(session.Username)
+	if err != nil {
+		s.renderErr(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
+
+// normalizeRecoveryCode forgives dashes, spaces & capitals
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
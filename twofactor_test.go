@@ -0,0 +1,183 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"git.j3s.sh/vore/totp"
+)
+
+var (
+	secretRe       = regexp.MustCompile(`name="secret" value="([A-Z2-7]+)"`)
+	recoveryCodeRe = regexp.MustCompile(`\b[0-9a-f]{5}-[0-9a-f]{5}\b`)
+)
+
+// enrollTOTP turns on two-factor auth for the session's user,
+// returning their secret and recovery codes
+func enrollTOTP(t *testing.T, s *Site, h http.Handler, session *http.Cookie) (string, []string) {
+	t.Helper()
+	w := do(h, "GET", "/settings/2fa", nil, session)
+	m := secretRe.FindStringSubmatch(w.Body.String())
+	if m == nil {
+		t.Fatalf("setup page should show a secret: %s", w.Body)
+	}
+	secret := m[1]
+
+	code, _ := totp.Code(secret, totp.Step(s.now()))
+	w = do(h, "POST", "/settings/2fa/enable", url.Values{"secret": {secret}, "code": {code}}, session)
+	if w.Code != http.StatusOK {
+		t.Fatalf("enable: got status %d: %s", w.Code, w.Body)
+	}
+	codes := recoveryCodeRe.FindAllString(w.Body.String(), -1)
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("got %d recovery codes, want %d", len(codes), recoveryCodeCount)
+	}
+	return secret, codes
+}
+
+// fixedClock pins the site's two-factor clock, returning
+// a func that moves it forward
+func fixedClock(s *Site) func(time.Duration) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	s.challenges.now = s.now
+	return func(d time.Duration) { now = now.Add(d) }
+}
+
+// startLogin submits the password step, returning the challenge cookie
+func startLogin(t *testing.T, h http.Handler, username string, password string) *http.Cookie {
+	t.Helper()
+	w := do(h, "POST", "/login", url.Values{"username": {username}, "password": {password}})
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/login/2fa" {
+		t.Fatalf("got status %d to %s, want a redirect to /login/2fa", w.Code, w.Header().Get("Location"))
+	}
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "session_token" {
+			t.Fatal("no session should be handed out before the second factor")
+		}
+		if c.Name == challengeCookie {
+			return c
+		}
+	}
+	t.Fatal("no challenge cookie")
+	return nil
+}
+
+func secondFactor(h http.Handler, challenge *http.Cookie, code string) *http.Response {
+	return do(h, "POST", "/login/2fa", url.Values{"code": {code}}, challenge).Result()
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	s, h := newTestSite(t)
+	advance := fixedClock(s)
+	session := register(t, h, "jes", "correct horse")
+	secret, _ := enrollTOTP(t, s, h, session)
+
+	challenge := startLogin(t, h, "jes", "correct horse")
+
+	// the code used to enroll can't be used again
+	code, _ := totp.Code(secret, totp.Step(s.now()))
+	if resp := secondFactor(h, challenge, code); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("replayed code: got status %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+
+	advance(totp.Period)
+	code, _ = totp.Code(secret, totp.Step(s.now()))
+	resp := secondFactor(h, challenge, code)
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("got status %d, want %d", resp.StatusCode, http.StatusSeeOther)
+	}
+	var got *http.Cookie
+	for _, c := range resp.Cookies() {
+		if c.Name == "session_token" {
+			got = c
+		}
+	}
+	if got == nil {
+		t.Fatal("no session cookie after the second factor")
+	}
+	if w := do(h, "GET", "/settings", nil, got); w.Code != http.StatusOK {
+		t.Fatalf("new session: got status %d", w.Code)
+	}
+
+	// the challenge is spent
+	advance(totp.Period)
+	code, _ = totp.Code(secret, totp.Step(s.now()))
+	if resp := secondFactor(h, challenge, code); resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/login" {
+		t.Fatalf("spent challenge: got status %d to %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+}
+
+func TestTwoFactorRecoveryCode(t *testing.T) {
+	s, h := newTestSite(t)
+	fixedClock(s)
+	session := register(t, h, "jes", "correct horse")
+	_, codes := enrollTOTP(t, s, h, session)
+
+	challenge := startLogin(t, h, "jes", "correct horse")
+	if resp := secondFactor(h, challenge, "NOT-A-CODE"); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("bad code: got status %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+	// recovery codes don't care about dashes or capitals
+	if resp := secondFactor(h, challenge, " "+codes[0][:5]+codes[0][6:]); resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("recovery code: got status %d, want %d", resp.StatusCode, http.StatusSeeOther)
+	}
+	if got := s.db.RecoveryCodesLeft("jes"); got != recoveryCodeCount-1 {
+		t.Fatalf("got %d recovery codes left, want %d", got, recoveryCodeCount-1)
+	}
+
+	challenge = startLogin(t, h, "jes", "correct horse")
+	if resp := secondFactor(h, challenge, codes[0]); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("reused recovery code: got status %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+}
+
+func TestTwoFactorChallengeExpires(t *testing.T) {
+	s, h := newTestSite(t)
+	advance := fixedClock(s)
+	session := register(t, h, "jes", "correct horse")
+	secret, _ := enrollTOTP(t, s, h, session)
+
+	challenge := startLogin(t, h, "jes", "correct horse")
+	advance(challengeLifetime)
+	code, _ := totp.Code(secret, totp.Step(s.now()))
+	if resp := secondFactor(h, challenge, code); resp.Header.Get("Location") != "/login" {
+		t.Fatalf("expired challenge: got status %d to %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+}
+
+func TestTwoFactorEnableWrongCode(t *testing.T) {
+	s, h := newTestSite(t)
+	fixedClock(s)
+	session := register(t, h, "jes", "correct horse")
+	secret, _ := totp.GenerateSecret()
+	code, _ := totp.Code(secret, totp.Step(s.now())+5)
+
+	w := do(h, "POST", "/settings/2fa/enable", url.Values{"secret": {secret}, "code": {code}}, session)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if s.db.GetTOTPSecret("jes") != "" {
+		t.Fatal("two-factor auth should still be off")
+	}
+}
+
+func TestTwoFactorDisable(t *testing.T) {
+	s, h := newTestSite(t)
+	fixedClock(s)
+	session := register(t, h, "jes", "correct horse")
+	enrollTOTP(t, s, h, session)
+
+	w := do(h, "POST", "/settings/2fa/disable", url.Values{"password": {"wrong password"}}, session)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong password: got status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	w = do(h, "POST", "/settings/2fa/disable", url.Values{"password": {"correct horse"}}, session)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	login(t, h, "jes", "correct horse")
+}
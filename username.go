@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	minUsernameLength = 2
+	maxUsernameLength = 32
+)
+
+// errUsernameTaken means somebody already has the username,
+// possibly with different capitalization
+var errUsernameTaken = errors.New("username is taken")
+
+// validateUsername checks that username is safe to hand out as a
+// homepage at /{username}. plain ascii only: no slashes or spaces
+// that break the url, no unicode lookalikes of other users, and
+// nothing that collides with one of the site's own routes.
+func (s *Site) validateUsername(username string) error {
+	if len(username) < minUsernameLength || len(username) > maxUsernameLength {
+		return fmt.Errorf("username must be %d to %d characters long", minUsernameLength, maxUsernameLength)
+	}
+	for i, r := range username {
+		alnum := ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9')
+		if alnum || (i > 0 && (r == '-' || r == '_')) {
+			continue
+		}
+		return fmt.Errorf("username may only contain a-z, 0-9, - and _, and must start with a letter or number")
+	}
+	if s.reservedUsernames()[strings.ToLower(username)] {
+		return fmt.Errorf("username '%s' is reserved", username)
+	}
+	return nil
+}
+
+// reservedUsernames is the first path segment of every route the site
+// serves. a user with one of these names would never see their homepage,
+// since the mux prefers the more specific route.
+func (s *Site) reservedUsernames() map[string]bool {
+	reserved := make(map[string]bool)
+	for _, rt := range s.routeTable() {
+		first, _, _ := strings.Cut(strings.TrimPrefix(patternPath(rt.pattern), "/"), "/")
+		if first == "" || strings.HasPrefix(first, "{") {
+			continue
+		}
+		reserved[strings.ToLower(first)] = true
+	}
+	return reserved
+}
+
+// patternPath strips the method, if any, off a mux pattern
+func patternPath(pattern string) string {
+	if _, path, ok := strings.Cut(pattern, " "); ok {
+		return path
+	}
+	return pattern
+}
+
+// usernameConflicts describes every existing username that wouldn't
+// be accepted today: invalid or reserved names, and names that only
+// differ from another user's by case.
+func (s *Site) usernameConflicts(usernames []string) []string {
+	var conflicts []string
+	folded := make(map[string][]string)
+	for _, u := range usernames {
+		if err := s.validateUsername(u); err != nil {
+			conflicts = append(conflicts, fmt.Sprintf("user '%s': %s", u, err))
+		}
+		folded[strings.ToLower(u)] = append(folded[strings.ToLower(u)], u)
+	}
+	for _, users := range folded {
+		if len(users) > 1 {
+			conflicts = append(conflicts, fmt.Sprintf("users %s only differ by case", strings.Join(users, ", ")))
+		}
+	}
+	sort.Strings(conflicts)
+	return conflicts
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateUsername(t *testing.T) {
+	s, _ := newTestSite(t)
+	valid := []string{"jes", "j3s", "Wesley", "forest_fire", "a-b", "xx"}
+	for _, u := range valid {
+		if err := s.validateUsername(u); err != nil {
+			t.Errorf("%q should be valid: %s", u, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"j",
+		strings.Repeat("j", 33),
+		"jes/settings",
+		"jes smith",
+		"-jes",
+		"_jes",
+		"jes.txt",
+		"jеs", // cyrillic е
+		"settings",
+		"Settings",
+		"login",
+		"static",
+		"saves",
+		"feeds",
+	}
+	for _, u := range invalid {
+		if err := s.validateUsername(u); err == nil {
+			t.Errorf("%q should be invalid", u)
+		}
+	}
+}
+
+func TestReservedUsernamesFollowRoutes(t *testing.T) {
+	s, _ := newTestSite(t)
+	reserved := s.reservedUsernames()
+	for _, rt := range s.routeTable() {
+		first, _, _ := strings.Cut(strings.TrimPrefix(patternPath(rt.pattern), "/"), "/")
+		if first == "" || strings.HasPrefix(first, "{") {
+			continue
+		}
+		if !reserved[first] {
+			t.Errorf("route %s should reserve %q", rt.pattern, first)
+		}
+	}
+	if reserved["{username}"] || reserved[""] {
+		t.Error("wildcards should not be reserved")
+	}
+}
+
+func TestRegisterCaseFoldedUniqueness(t *testing.T) {
+	_, h := newTestSite(t)
+	register(t, h, "jes", "correct horse")
+
+	w := do(h, "POST", "/register", url.Values{"username": {"JES"}, "password": {"correct horse"}})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestRegisterRejectsReservedName(t *testing.T) {
+	s, h := newTestSite(t)
+	w := do(h, "POST", "/register", url.Values{"username": {"settings"}, "password": {"correct horse"}})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if s.db.UserExists("settings") {
+		t.Fatal("user 'settings' should not exist")
+	}
+}
+
+func TestUsernameConflicts(t *testing.T) {
+	s, _ := newTestSite(t)
+	got := s.usernameConflicts([]string{"jes", "Jes", "settings", "ok_user", "has space"})
+	want := []string{
+		"user 'has space': username may only contain a-z, 0-9, - and _, and must start with a letter or number",
+		"user 'settings': username 'settings' is reserved",
+		"users jes, Jes only differ by case",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q\nwant %q", got, want)
+	}
+}